@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
+	"sync"
+	"time"
 
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
@@ -18,7 +21,7 @@ import (
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
-	ctrl "sigs.k8s.io/controller-runtime"
+	"k8s.io/utils/pointer"
 )
 
 // Applier provides a way to apply unstructured Kubernetes resources to the API without knowing their respective schemes
@@ -28,11 +31,39 @@ type Applier struct {
 	dynClient    dynClient
 	scheme       *runtime.Scheme
 	fieldManager string
+
+	crdEstablishTimeout  time.Duration
+	crdEstablishInterval time.Duration
+	crdMutex             sync.Mutex
+	appliedCRDs          map[schema.GroupKind]string
+
+	namespacePolicy NamespacePolicy
+
+	logger         Logger
+	forceConflicts bool
 }
 
 // YamlDocument is an alias type for exactly one single YAML document.
 type YamlDocument []byte
 
+// ApplyOptions contains optional settings which control how a single YAML document is applied.
+type ApplyOptions struct {
+	// Owner is set as controller reference of the applied resource if it is not nil. Resources which cannot
+	// reference the owner get the owner label instead, see Applier.DeleteOwnedResources.
+	Owner metav1.Object
+	// OwnerReferences are set in addition to Owner. Only one of all owners can be the controller.
+	OwnerReferences []OwnerReference
+	// DryRun sends the request as server-side dry-run. The API server runs admission, validation and defaulting but
+	// does not persist the resource.
+	DryRun bool
+	// Labels are added to the labels of the applied resource. Labels from the YAML document are overwritten on
+	// conflict.
+	Labels map[string]string
+	// NamespacePolicy decides whether a namespace declared in the document is kept. The policy of the Applier is used
+	// if it is empty, see Applier.WithNamespacePolicy.
+	NamespacePolicy NamespacePolicy
+}
+
 // New returns a `kubectl`-like apply client which operates on the K8s API with YAML resources.
 //
 // Both parameters clusterConfig and fieldManager are mandatory parameters. ClusterConfig contains values how to
@@ -40,35 +71,27 @@ type YamlDocument []byte
 // which are about to apply so that unexpected changes can be detected. A sensible value might be the name of the
 // calling application. See also: https://kubernetes.io/docs/reference/using-api/server-side-apply/#field-management
 //
-// This method also returns a runtime.Scheme which will be used to properly handle owner references (most important when
-// working with your own CRD). Use it like this:
+// This method also returns a runtime.Scheme which is used to determine the kind of owners for owner references. Owners
+// whose type is not registered are resolved by their TypeMeta or by the API server's REST mapping of their type name,
+// so registering types is only necessary for ambiguous kinds. Use NewWithScheme to reuse an existing scheme.
 //
 //	applier, scheme, err := apply.New(config, "your-field-manager-name")
 //	yourCrdGroupVersion.AddToScheme(scheme)
 func New(clusterConfig *rest.Config, fieldManager string) (*Applier, *runtime.Scheme, error) {
-	if strings.TrimSpace(fieldManager) == "" {
-		return nil, nil, errors.New("cannot create new Applier: fieldManager must not be empty")
-	}
+	schemeForCrdHandling := runtime.NewScheme()
 
-	gvrMapper, err := createGVRMapper(clusterConfig)
-	if err != nil {
-		return nil, nil, fmt.Errorf("error while creating GVR mapper: %w", err)
-	}
-	dynCli, err := createDynamicClient(clusterConfig)
+	applier, err := NewWithScheme(clusterConfig, fieldManager, schemeForCrdHandling)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error while creating dynamic client: %w", err)
+		return nil, nil, err
 	}
 
-	schemeForCrdHandling := runtime.NewScheme()
+	return applier, schemeForCrdHandling, nil
+}
 
-	return &Applier{
-			gvrMapper:    gvrMapper,
-			dynClient:    dynCli,
-			scheme:       schemeForCrdHandling,
-			fieldManager: fieldManager,
-		},
-		schemeForCrdHandling,
-		nil
+// NewWithScheme works like New but uses the given scheme, f. i. the scheme of a controller-runtime manager
+// (mgr.GetScheme()), to determine the kind of owners. See NewWithOptions for further settings.
+func NewWithScheme(clusterConfig *rest.Config, fieldManager string, scheme *runtime.Scheme) (*Applier, error) {
+	return NewWithOptions(clusterConfig, fieldManager, WithScheme(scheme))
 }
 
 func createGVRMapper(config *rest.Config) (meta.RESTMapper, error) {
@@ -88,67 +111,243 @@ func createDynamicClient(config *rest.Config) (dynamic.Interface, error) {
 
 // Apply sends a request to the K8s API with the provided YAML resource in order to apply them to the current cluster.
 func (ac *Applier) Apply(yamlResource YamlDocument, namespace string) error {
-	return ac.ApplyWithOwner(yamlResource, namespace, nil)
+	return ac.ApplyContext(context.Background(), yamlResource, namespace)
+}
+
+// ApplyContext sends a request to the K8s API with the provided YAML resource in order to apply them to the current
+// cluster. The request is aborted once the given context is cancelled or exceeds its deadline.
+func (ac *Applier) ApplyContext(ctx context.Context, yamlResource YamlDocument, namespace string) error {
+	return ac.ApplyWithOwnerContext(ctx, yamlResource, namespace, nil)
 }
 
 // ApplyWithOwner sends a request to the K8s API with the provided YAML resource in order to apply them to the current cluster.
 func (ac *Applier) ApplyWithOwner(yamlResource YamlDocument, namespace string, owningResource metav1.Object) error {
-	GetLogger().Debug("Applying K8s resource")
-	GetLogger().Debug(string(yamlResource))
+	return ac.ApplyWithOwnerContext(context.Background(), yamlResource, namespace, owningResource)
+}
+
+// ApplyWithOwnerContext sends a request to the K8s API with the provided YAML resource in order to apply them to the
+// current cluster. The request is aborted once the given context is cancelled or exceeds its deadline.
+//
+// Lists like v1.List or v1.ConfigMapList and JSON arrays are expanded into their items which are applied one after
+// another. Applying stops at the first item which fails.
+func (ac *Applier) ApplyWithOwnerContext(ctx context.Context, yamlResource YamlDocument, namespace string, owningResource metav1.Object) error {
+	items, isList, err := expandDocument(yamlResource)
+	if err != nil {
+		return fmt.Errorf("could not expand list document: %w", err)
+	}
+	if !isList {
+		items = []YamlDocument{yamlResource}
+	}
+
+	for i, item := range items {
+		_, err = ac.ApplyWithOptions(ctx, item, namespace, ApplyOptions{Owner: owningResource})
+		if err != nil && isList {
+			return fmt.Errorf("could not apply item %d: %w", i+1, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
+// ApplyWithOptions sends a request to the K8s API with the provided YAML resource in order to apply them to the
+// current cluster and returns the resource as it was computed by the API server. With ApplyOptions.DryRun the
+// returned resource shows what would have been persisted.
+//
+// The live resource is fetched before the apply in order to tell whether the resource was created, configured or
+// left unchanged. If the applier may not get the resource, it is applied anyway and the operation is
+// ApplyOperationUnknown. A conflicting controller is then only detected if the owner reference is rejected by the API
+// server.
+//
+// If the request fails after the resource was resolved, a result without Object is returned along with the error so
+// that callers can identify the resource by its actual namespace and name.
+func (ac *Applier) ApplyWithOptions(ctx context.Context, yamlResource YamlDocument, namespace string, opts ApplyOptions) (*ResourceResult, error) {
+	ac.log().Debug("Applying K8s resource")
+	ac.log().Debug(string(yamlResource))
+	start := time.Now()
+
+	k8sObjects, mapping, dr, err := ac.prepareResource(ctx, yamlResource, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := &ResourceResult{
+		GroupVersionKind:     mapping.GroupVersionKind,
+		GroupVersionResource: mapping.Resource,
+		Namespace:            k8sObjects.GetNamespace(),
+		Name:                 k8sObjects.GetName(),
+	}
+
+	liveKnown := true
+	live, err := dr.Get(ctx, k8sObjects.GetName(), metav1.GetOptions{})
+	switch {
+	case k8serrors.IsNotFound(err):
+		live = nil
+	case k8serrors.IsForbidden(err):
+		ac.log().Debug(fmt.Sprintf("Applying resource %s/%s/%s without knowing its live state: %v", k8sObjects.GetKind(), k8sObjects.GetAPIVersion(), k8sObjects.GetName(), err))
+		live, liveKnown = nil, false
+	case err != nil:
+		return resolved, NewResourceError(err, "error while fetching live resource", k8sObjects.GetKind(), k8sObjects.GetAPIVersion(), k8sObjects.GetName())
+	}
+
+	err = checkController(live, k8sObjects)
+	if err != nil {
+		return resolved, NewResourceError(err, "error while setting owner", k8sObjects.GetKind(), k8sObjects.GetAPIVersion(), k8sObjects.GetName())
+	}
+
+	applied, err := ac.createOrUpdateResource(ctx, k8sObjects, dr, opts.DryRun)
+	if err != nil {
+		return resolved, err
+	}
+
+	if !opts.DryRun {
+		ac.trackAppliedCRD(k8sObjects)
+	}
+
+	operation := ApplyOperationUnknown
+	if liveKnown {
+		operation = applyOperation(live, applied, opts.DryRun)
+	}
+
+	return &ResourceResult{
+		Object:               applied,
+		GroupVersionKind:     mapping.GroupVersionKind,
+		GroupVersionResource: mapping.Resource,
+		Namespace:            applied.GetNamespace(),
+		Name:                 applied.GetName(),
+		UID:                  applied.GetUID(),
+		ResourceVersion:      applied.GetResourceVersion(),
+		Operation:            operation,
+		Duration:             time.Since(start),
+	}, nil
+}
+
+// applyOperation compares the resource versions of the live and the applied resource. A dry-run does not change the
+// resource version, so the resources are compared like in Applier.Diff instead.
+func applyOperation(live, applied *unstructured.Unstructured, dryRun bool) ApplyOperation {
+	if live == nil {
+		return ApplyOperationCreated
+	}
+
+	if dryRun {
+		diff, err := diffResources(live, applied)
+		if err == nil && diff == "" {
+			return ApplyOperationUnchanged
+		}
+		return ApplyOperationConfigured
+	}
+
+	if live.GetResourceVersion() == applied.GetResourceVersion() {
+		return ApplyOperationUnchanged
+	}
+	return ApplyOperationConfigured
+}
+
+// prepareResource decodes the YAML resource, sets namespace and owner references and returns the REST mapping and
+// interface which serve the resource.
+func (ac *Applier) prepareResource(ctx context.Context, yamlResource YamlDocument, namespace string, opts ApplyOptions) (*unstructured.Unstructured, *meta.RESTMapping, dynamic.ResourceInterface, error) {
 	// 3. Decode YAML manifest into unstructured.Unstructured
 	var decUnstructured = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
 	k8sObjects := &unstructured.Unstructured{}
 	_, gvk, err := decUnstructured.Decode(yamlResource, nil, k8sObjects)
 	if err != nil {
-		return fmt.Errorf("could not decode YAML document '%s': %w", string(yamlResource), err)
+		return nil, nil, nil, fmt.Errorf("could not decode YAML document '%s': %w", string(yamlResource), err)
 	}
 
 	// 4. Map GVK to GVR
 	// a resource can be uniquely identified by GroupVersionResource, but we need the GVK to find the corresponding GVR
-	gvr, err := ac.gvrMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	gvr, err := ac.restMapping(ctx, gvk.GroupKind(), gvk.Version)
 	if err != nil {
-		return fmt.Errorf("could not find GVK mapper for GroupKind=%v,Version=%s and YAML document '%s': %w", gvk.GroupKind(), gvk.Version, string(yamlResource), err)
+		return nil, nil, nil, fmt.Errorf("could not find GVK mapper for GroupKind=%v,Version=%s and YAML document '%s': %w", gvk.GroupKind(), gvk.Version, string(yamlResource), err)
 	}
 
+	addLabels(k8sObjects, opts.Labels)
+
 	// 5. Obtain REST interface for the GVR
 	var dr dynamic.ResourceInterface
 	if gvr.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace, err = resolveNamespace(k8sObjects, namespace, ac.effectiveNamespacePolicy(opts.NamespacePolicy))
+		if err != nil {
+			return nil, nil, nil, err
+		}
 		k8sObjects.SetNamespace(namespace)
 		// namespaced resources should specify the namespace
 		dr = ac.dynClient.Resource(gvr.Resource).Namespace(namespace)
-
-		if owningResource != nil {
-			err = ctrl.SetControllerReference(owningResource, k8sObjects, ac.scheme)
-			if err != nil {
-				return fmt.Errorf("could not apply YAML document '%s': could not set controller reference: %w", string(yamlResource), err)
-			}
-		}
 	} else {
 		// for cluster-wide resources
 		dr = ac.dynClient.Resource(gvr.Resource)
 	}
 
-	return ac.createOrUpdateResource(context.Background(), k8sObjects, dr)
+	err = setOwners(opts.ownerReferences(), k8sObjects, gvr.Scope.Name() == meta.RESTScopeNameNamespace, ac.ownerKinds())
+	var alreadyOwnedErr *AlreadyOwnedError
+	if errors.As(err, &alreadyOwnedErr) {
+		return nil, nil, nil, NewResourceError(err, "error while setting owner", k8sObjects.GetKind(), k8sObjects.GetAPIVersion(), k8sObjects.GetName())
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not apply YAML document '%s': %w", string(yamlResource), err)
+	}
+
+	return k8sObjects, gvr, dr, nil
+}
+
+func addLabels(resource *unstructured.Unstructured, additionalLabels map[string]string) {
+	if len(additionalLabels) == 0 {
+		return
+	}
+
+	labels := resource.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string, len(additionalLabels))
+	}
+	for key, value := range additionalLabels {
+		labels[key] = value
+	}
+	resource.SetLabels(labels)
+}
+
+// restMapping looks up the RESTMapping for the given GroupKind. The discovery client behind the mapper does not accept
+// a context, so the context is checked before the lookup which may hit the API. Unknown kinds are looked up again
+// after the discovery cache was reset, see retryRESTMapping.
+func (ac *Applier) restMapping(ctx context.Context, gk schema.GroupKind, version string) (*meta.RESTMapping, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mapping, err := ac.gvrMapper.RESTMapping(gk, version)
+	if meta.IsNoMatchError(err) {
+		return ac.retryRESTMapping(ctx, gk, version, err)
+	}
+
+	return mapping, err
 }
 
-func (ac *Applier) createOrUpdateResource(ctx context.Context, desiredResource *unstructured.Unstructured, dr dynamic.ResourceInterface) error {
-	GetLogger().Debug(fmt.Sprintf("Patching resource %s/%s/%s", desiredResource.GetKind(), desiredResource.GetAPIVersion(), desiredResource.GetName()))
+func (ac *Applier) createOrUpdateResource(ctx context.Context, desiredResource *unstructured.Unstructured, dr dynamic.ResourceInterface, dryRun bool) (*unstructured.Unstructured, error) {
+	ac.log().Debug(fmt.Sprintf("Patching resource %s/%s/%s", desiredResource.GetKind(), desiredResource.GetAPIVersion(), desiredResource.GetName()))
 	// 6. marshal unstructured resource into proper JSON
 	jsondata, err := json.Marshal(desiredResource)
 	if err != nil {
-		return NewResourceError(err, "error while parsing resource to json", desiredResource.GetKind(), desiredResource.GetAPIVersion(), desiredResource.GetName())
+		return nil, NewResourceError(err, "error while parsing resource to json", desiredResource.GetKind(), desiredResource.GetAPIVersion(), desiredResource.GetName())
 	}
 
 	// 7. Update the object with server-side-apply
 	//    types.ApplyPatchType indicates server-side-apply.
 	//    FieldManager specifies the field owner ID.
-	_, err = dr.Patch(ctx, desiredResource.GetName(), types.ApplyPatchType, jsondata, metav1.PatchOptions{
+	patchOptions := metav1.PatchOptions{
 		FieldManager: ac.fieldManager,
-	})
+	}
+	if dryRun {
+		patchOptions.DryRun = []string{metav1.DryRunAll}
+	}
+	if ac.forceConflicts {
+		patchOptions.Force = pointer.Bool(true)
+	}
+
+	result, err := dr.Patch(ctx, desiredResource.GetName(), types.ApplyPatchType, jsondata, patchOptions)
 	if err != nil {
-		return NewResourceError(err, "error while patching", desiredResource.GetKind(), desiredResource.GetAPIVersion(), desiredResource.GetName())
+		return nil, NewResourceError(err, "error while patching", desiredResource.GetKind(), desiredResource.GetAPIVersion(), desiredResource.GetName())
 	}
 
-	return nil
+	return result, nil
 }
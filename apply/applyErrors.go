@@ -0,0 +1,38 @@
+package apply
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ApplyErrors is returned by a Builder run with WithContinueOnError if at least one YAML document could not be
+// applied. It contains one ResourceError per failed document in document order. errors.Is and errors.As inspect all
+// contained errors.
+type ApplyErrors struct {
+	errs []*ResourceError
+}
+
+// Error returns the string representation of this error.
+func (e *ApplyErrors) Error() string {
+	messages := make([]string, 0, len(e.errs))
+	for _, err := range e.errs {
+		messages = append(messages, err.Error())
+	}
+
+	return fmt.Sprintf("%d document(s) could not be applied:\n%s", len(e.errs), strings.Join(messages, "\n"))
+}
+
+// Unwrap returns the errors of all failed documents.
+func (e *ApplyErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e.errs))
+	for _, err := range e.errs {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Errors returns the errors of all failed documents.
+func (e *ApplyErrors) Errors() []*ResourceError {
+	return e.errs
+}
@@ -0,0 +1,39 @@
+package apply
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyErrors(t *testing.T) {
+	otherErr := errors.New("other error")
+	sut := &ApplyErrors{errs: []*ResourceError{
+		NewResourceError(assert.AnError, "first", "ConfigMap", "v1", "cm-1"),
+		NewResourceError(otherErr, "second", "ConfigMap", "v1", "cm-2"),
+	}}
+
+	t.Run("should list all errors", func(t *testing.T) {
+		assert.Equal(t, "2 document(s) could not be applied:\n"+
+			"first (resource ConfigMap/v1/cm-1): assert.AnError general error for testing\n"+
+			"second (resource ConfigMap/v1/cm-2): other error", sut.Error())
+	})
+	t.Run("should support errors.Is and errors.As", func(t *testing.T) {
+		assert.ErrorIs(t, sut, assert.AnError)
+		assert.ErrorIs(t, sut, otherErr)
+
+		var resourceErr *ResourceError
+		require.ErrorAs(t, sut, &resourceErr)
+		assert.Equal(t, "cm-1", resourceErr.Name())
+	})
+	t.Run("should support errors.Join", func(t *testing.T) {
+		joined := errors.Join(sut, errors.New("unrelated"))
+
+		var applyErrs *ApplyErrors
+		require.ErrorAs(t, joined, &applyErrs)
+		assert.Len(t, applyErrs.Errors(), 2)
+		assert.ErrorIs(t, joined, otherErr)
+	})
+}
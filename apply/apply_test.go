@@ -1,6 +1,7 @@
 package apply
 
 import (
+	"context"
 	v1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"testing"
@@ -8,14 +9,52 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 )
 
 const testFieldManagerName = "my-app-controller"
 
+var (
+	testConfigMapMapping = &meta.RESTMapping{
+		Resource:         schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+		Scope:            meta.RESTScopeNamespace,
+	}
+	testServiceAccountMapping = &meta.RESTMapping{
+		Resource:         schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"},
+		GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"},
+		Scope:            meta.RESTScopeNamespace,
+	}
+	testJobMapping = &meta.RESTMapping{
+		Resource:         schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"},
+		GroupVersionKind: schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"},
+		Scope:            meta.RESTScopeNamespace,
+	}
+)
+
+// newMappedApplier creates an Applier which resolves the kind of the given mapping and serves its resource in the
+// given namespace. Expectations for the API requests are set on the returned resource interface.
+func newMappedApplier(t *testing.T, mapping *meta.RESTMapping, namespace string) (*Applier, *mockNamespaceInterface) {
+	t.Helper()
+
+	gvk := mapping.GroupVersionKind
+	gvrMapperMock := newMockGvrMapper(t)
+	gvrMapperMock.EXPECT().RESTMapping(gvk.GroupKind(), gvk.Version).Return(mapping, nil)
+
+	apiInterfaceMock := newMockNamespaceInterface(t)
+	apiInterfaceMock.EXPECT().Namespace(namespace).Return(apiInterfaceMock)
+	dynClientMock := newMockDynClient(t)
+	dynClientMock.EXPECT().Resource(mapping.Resource).Return(apiInterfaceMock)
+
+	return &Applier{gvrMapper: gvrMapperMock, dynClient: dynClientMock, fieldManager: testFieldManagerName}, apiInterfaceMock
+}
+
 func TestNew(t *testing.T) {
 	t.Run("should create a new Applier", func(t *testing.T) {
 		actual, scheme, _ := New(&rest.Config{}, testFieldManagerName)
@@ -37,6 +76,28 @@ func TestNew(t *testing.T) {
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "error while creating GVR mapper")
 	})
+	t.Run("should return the scheme used by the Applier", func(t *testing.T) {
+		actual, scheme, _ := New(&rest.Config{}, testFieldManagerName)
+
+		assert.Same(t, scheme, actual.scheme)
+	})
+}
+
+func TestNewWithScheme(t *testing.T) {
+	t.Run("should use the given scheme", func(t *testing.T) {
+		scheme := runtime.NewScheme()
+
+		actual, err := NewWithScheme(&rest.Config{}, testFieldManagerName, scheme)
+
+		require.NoError(t, err)
+		assert.Same(t, scheme, actual.scheme)
+	})
+	t.Run("should fail for empty field manager name", func(t *testing.T) {
+		_, err := NewWithScheme(&rest.Config{}, "", runtime.NewScheme())
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "fieldManager must not be empty")
+	})
 }
 
 func Test_Applier_implements_interface(t *testing.T) {
@@ -44,6 +105,12 @@ func Test_Applier_implements_interface(t *testing.T) {
 
 	require.NoError(t, err)
 	assert.Implements(t, (*applier)(nil), sut)
+	assert.Implements(t, (*optionsApplier)(nil), sut)
+	assert.Implements(t, (*differ)(nil), sut)
+	assert.Implements(t, (*pruner)(nil), sut)
+	assert.Implements(t, (*inventoryReader)(nil), sut)
+	assert.Implements(t, (*deleter)(nil), sut)
+	assert.Implements(t, (*readinessWaiter)(nil), sut)
 }
 
 func Test_Applier_Apply(t *testing.T) {
@@ -72,6 +139,8 @@ func Test_Applier_Apply(t *testing.T) {
 		apiInterfaceMock := newMockNamespaceInterface(t)
 		apiInterfaceMock.EXPECT().Namespace(mock.Anything).
 			Return(apiInterfaceMock)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "the-best-resource-in-store", metav1.GetOptions{}).
+			Return(nil, k8serrors.NewNotFound(schema.GroupResource{}, "the-best-resource-in-store"))
 		apiInterfaceMock.EXPECT().Patch(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 			Return(unstructuredResultMock, nil)
 
@@ -118,6 +187,8 @@ metadata:
 		unstructuredResultMock := &unstructured.Unstructured{Object: parsedJsonResult}
 
 		apiInterfaceMock := newMockNamespaceInterface(t)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "the-best-resource-in-store", metav1.GetOptions{}).
+			Return(nil, k8serrors.NewNotFound(schema.GroupResource{}, "the-best-resource-in-store"))
 		apiInterfaceMock.EXPECT().Patch(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 			Return(unstructuredResultMock, nil)
 
@@ -205,6 +276,8 @@ func Test_Applier_ApplyWithOwner(t *testing.T) {
 		}
 		gvrMapperMock := newMockGvrMapper(t)
 		gvrMapperMock.EXPECT().RESTMapping(expectedResourceGroupKind, "v1").Return(mockedRestMapping, nil)
+		gvrMapperMock.EXPECT().KindFor(schema.GroupVersionResource{Resource: "deployments"}).
+			Return(schema.GroupVersionKind{}, &meta.NoResourceMatchError{})
 
 		apiInterfaceMock := newMockNamespaceInterface(t)
 		apiInterfaceMock.EXPECT().Namespace("mynamespace").Return(nil)
@@ -215,6 +288,7 @@ func Test_Applier_ApplyWithOwner(t *testing.T) {
 		sut := Applier{
 			gvrMapper: gvrMapperMock,
 			dynClient: dynClientMock,
+			scheme:    runtime.NewScheme(),
 		}
 
 		testResource := []byte(`apiVersion: v1
@@ -223,9 +297,11 @@ metadata:
   name: the-best-resource-in-store
   namespace: ecosystem`)
 
+		// neither the scheme nor the REST mapper know deployments
 		owningResource := &v1.Deployment{
 			ObjectMeta: metav1.ObjectMeta{
-				Namespace: "otherNamespace",
+				Namespace: "mynamespace",
+				UID:       "4711",
 			},
 		}
 
@@ -236,6 +312,7 @@ metadata:
 		require.Error(t, err)
 		assert.ErrorContains(t, err, "could not apply YAML document")
 		assert.ErrorContains(t, err, "could not set controller reference")
+		assert.ErrorContains(t, err, "could not determine the kind of owner")
 	})
 
 	t.Run("should fail to PATCH resource", func(t *testing.T) {
@@ -258,6 +335,8 @@ metadata:
 		gvrMapperMock.EXPECT().RESTMapping(expectedResourceGroupKind, "v1").Return(mockedRestMapping, nil)
 
 		apiInterfaceMock := newMockNamespaceInterface(t)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "the-best-resource-in-store", metav1.GetOptions{}).
+			Return(nil, k8serrors.NewNotFound(schema.GroupResource{}, "the-best-resource-in-store"))
 		apiInterfaceMock.EXPECT().Patch(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 			Return(nil, assert.AnError)
 
@@ -284,3 +363,326 @@ metadata:
 		assert.ErrorContains(t, err, "error while patching")
 	})
 }
+
+func Test_Applier_ApplyWithOwnerContext(t *testing.T) {
+	t.Run("should not look up the RESTMapping for a cancelled context", func(t *testing.T) {
+		// given
+		sut := Applier{
+			gvrMapper: newMockGvrMapper(t),
+			dynClient: newMockDynClient(t),
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		testResource := []byte(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: the-best-resource-in-store`)
+
+		// when
+		err := sut.ApplyWithOwnerContext(ctx, testResource, "mynamespace", nil)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+	t.Run("should pass the context to the PATCH request", func(t *testing.T) {
+		// given
+		type ctxKey struct{}
+		ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+
+		expectedResourceGroupKind := schema.GroupKind{Group: "", Kind: "Namespace"}
+		mockedRestMapping := &meta.RESTMapping{
+			Resource: schema.GroupVersionResource{
+				Group:    "",
+				Version:  "v1",
+				Resource: "namespaces",
+			},
+			GroupVersionKind: schema.GroupVersionKind{
+				Group:   "",
+				Version: "v1",
+				Kind:    "Namespace",
+			},
+			Scope: meta.RESTScopeRoot,
+		}
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().RESTMapping(expectedResourceGroupKind, "v1").Return(mockedRestMapping, nil)
+
+		apiInterfaceMock := newMockNamespaceInterface(t)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "the-best-resource-in-store", metav1.GetOptions{}).
+			Return(nil, k8serrors.NewNotFound(schema.GroupResource{}, "the-best-resource-in-store"))
+		apiInterfaceMock.EXPECT().Patch(ctx, "the-best-resource-in-store", mock.Anything, mock.Anything, mock.Anything).
+			Return(&unstructured.Unstructured{}, nil)
+
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(mock.Anything).Return(apiInterfaceMock)
+
+		sut := Applier{
+			gvrMapper: gvrMapperMock,
+			dynClient: dynClientMock,
+		}
+
+		testResource := []byte(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: the-best-resource-in-store`)
+
+		// when
+		err := sut.ApplyWithOwnerContext(ctx, testResource, "mynamespace", nil)
+
+		// then
+		require.NoError(t, err)
+	})
+	t.Run("should apply the items of a list one after another and stop at the first failing item", func(t *testing.T) {
+		// given
+		expectedResourceGroupKind := schema.GroupKind{Group: "", Kind: "Namespace"}
+		mockedRestMapping := &meta.RESTMapping{
+			Resource:         schema.GroupVersionResource{Version: "v1", Resource: "namespaces"},
+			GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "Namespace"},
+			Scope:            meta.RESTScopeRoot,
+		}
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().RESTMapping(expectedResourceGroupKind, "v1").Return(mockedRestMapping, nil)
+
+		apiInterfaceMock := newMockNamespaceInterface(t)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "first", metav1.GetOptions{}).
+			Return(nil, k8serrors.NewNotFound(schema.GroupResource{}, "first"))
+		apiInterfaceMock.EXPECT().Patch(mock.Anything, "first", mock.Anything, mock.Anything, mock.Anything).
+			Return(&unstructured.Unstructured{}, nil)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "second", metav1.GetOptions{}).
+			Return(nil, k8serrors.NewNotFound(schema.GroupResource{}, "second"))
+		apiInterfaceMock.EXPECT().Patch(mock.Anything, "second", mock.Anything, mock.Anything, mock.Anything).
+			Return(nil, assert.AnError)
+
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(mock.Anything).Return(apiInterfaceMock)
+
+		sut := Applier{
+			gvrMapper: gvrMapperMock,
+			dynClient: dynClientMock,
+		}
+
+		testResource := []byte(`apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: first
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: second
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: third`)
+
+		// when
+		err := sut.ApplyWithOwnerContext(context.Background(), testResource, "mynamespace", nil)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "could not apply item 2")
+	})
+}
+
+func Test_Applier_ApplyWithOptions(t *testing.T) {
+	t.Run("should send a server-side dry-run and return the server-computed resource", func(t *testing.T) {
+		// given
+		expectedResourceGroupKind := schema.GroupKind{Group: "", Kind: "ServiceAccount"}
+		mockedRestMapping := &meta.RESTMapping{
+			Resource: schema.GroupVersionResource{
+				Group:    "",
+				Version:  "v1",
+				Resource: "serviceaccounts",
+			},
+			GroupVersionKind: schema.GroupVersionKind{
+				Group:   "",
+				Version: "v1",
+				Kind:    "ServiceAccount",
+			},
+			Scope: meta.RESTScopeNamespace,
+		}
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().RESTMapping(expectedResourceGroupKind, "v1").Return(mockedRestMapping, nil)
+
+		serverResult := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ServiceAccount"}}
+		expectedPatchOptions := metav1.PatchOptions{FieldManager: testFieldManagerName, DryRun: []string{metav1.DryRunAll}}
+		apiInterfaceMock := newMockNamespaceInterface(t)
+		apiInterfaceMock.EXPECT().Namespace("mynamespace").Return(apiInterfaceMock)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "the-best-resource-in-store", metav1.GetOptions{}).
+			Return(nil, k8serrors.NewNotFound(schema.GroupResource{}, "the-best-resource-in-store"))
+		apiInterfaceMock.EXPECT().Patch(mock.Anything, "the-best-resource-in-store", types.ApplyPatchType, mock.Anything, expectedPatchOptions).
+			Return(serverResult, nil)
+
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(mock.Anything).Return(apiInterfaceMock)
+
+		sut := Applier{
+			gvrMapper:    gvrMapperMock,
+			dynClient:    dynClientMock,
+			fieldManager: testFieldManagerName,
+		}
+
+		testResource := []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: the-best-resource-in-store`)
+
+		// when
+		actual, err := sut.ApplyWithOptions(context.Background(), testResource, "mynamespace", ApplyOptions{DryRun: true})
+
+		// then
+		require.NoError(t, err)
+		assert.Same(t, serverResult, actual.Object)
+		assert.Equal(t, ApplyOperationCreated, actual.Operation)
+	})
+	t.Run("should describe the applied resource", func(t *testing.T) {
+		tests := []struct {
+			name            string
+			liveVersion     string
+			expectOperation ApplyOperation
+		}{
+			{"unchanged resource", "42", ApplyOperationUnchanged},
+			{"configured resource", "41", ApplyOperationConfigured},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				// given
+				mockedRestMapping := &meta.RESTMapping{
+					Resource:         schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"},
+					GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"},
+					Scope:            meta.RESTScopeNamespace,
+				}
+				gvrMapperMock := newMockGvrMapper(t)
+				gvrMapperMock.EXPECT().RESTMapping(schema.GroupKind{Kind: "ServiceAccount"}, "v1").Return(mockedRestMapping, nil)
+
+				live := &unstructured.Unstructured{}
+				live.SetResourceVersion(tt.liveVersion)
+				serverResult := &unstructured.Unstructured{}
+				serverResult.SetNamespace("mynamespace")
+				serverResult.SetName("the-best-resource-in-store")
+				serverResult.SetUID("le-uid")
+				serverResult.SetResourceVersion("42")
+				apiInterfaceMock := newMockNamespaceInterface(t)
+				apiInterfaceMock.EXPECT().Namespace("mynamespace").Return(apiInterfaceMock)
+				apiInterfaceMock.EXPECT().Get(mock.Anything, "the-best-resource-in-store", metav1.GetOptions{}).Return(live, nil)
+				apiInterfaceMock.EXPECT().Patch(mock.Anything, "the-best-resource-in-store", types.ApplyPatchType, mock.Anything, mock.Anything).
+					Return(serverResult, nil)
+
+				dynClientMock := newMockDynClient(t)
+				dynClientMock.EXPECT().Resource(mockedRestMapping.Resource).Return(apiInterfaceMock)
+
+				sut := Applier{gvrMapper: gvrMapperMock, dynClient: dynClientMock, fieldManager: testFieldManagerName}
+
+				testResource := []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: the-best-resource-in-store`)
+
+				// when
+				actual, err := sut.ApplyWithOptions(context.Background(), testResource, "mynamespace", ApplyOptions{})
+
+				// then
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectOperation, actual.Operation)
+				assert.Equal(t, mockedRestMapping.GroupVersionKind, actual.GroupVersionKind)
+				assert.Equal(t, mockedRestMapping.Resource, actual.GroupVersionResource)
+				assert.Equal(t, "mynamespace", actual.Namespace)
+				assert.Equal(t, "the-best-resource-in-store", actual.Name)
+				assert.Equal(t, types.UID("le-uid"), actual.UID)
+				assert.Equal(t, "42", actual.ResourceVersion)
+				assert.Positive(t, actual.Duration)
+			})
+		}
+	})
+	t.Run("should apply without permission to get the live resource", func(t *testing.T) {
+		tests := []struct {
+			name              string
+			getErr            error
+			expectErr         string
+			expectedOperation ApplyOperation
+		}{
+			{
+				name:              "forbidden",
+				getErr:            k8serrors.NewForbidden(schema.GroupResource{Resource: "serviceaccounts"}, "the-best-resource-in-store", assert.AnError),
+				expectedOperation: ApplyOperationUnknown,
+			},
+			{
+				name:      "other error",
+				getErr:    assert.AnError,
+				expectErr: "error while fetching live resource",
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				// given
+				sut, apiInterfaceMock := newMappedApplier(t, testServiceAccountMapping, "mynamespace")
+				apiInterfaceMock.EXPECT().Get(mock.Anything, "the-best-resource-in-store", metav1.GetOptions{}).Return(nil, tt.getErr)
+				if tt.expectErr == "" {
+					apiInterfaceMock.EXPECT().Patch(mock.Anything, "the-best-resource-in-store", types.ApplyPatchType, mock.Anything, mock.Anything).
+						Return(&unstructured.Unstructured{}, nil)
+				}
+
+				testResource := []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: the-best-resource-in-store`)
+
+				// when
+				actual, err := sut.ApplyWithOptions(context.Background(), testResource, "mynamespace", ApplyOptions{})
+
+				// then
+				if tt.expectErr != "" {
+					require.Error(t, err)
+					assert.ErrorIs(t, err, tt.getErr)
+					assert.ErrorContains(t, err, tt.expectErr)
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedOperation, actual.Operation)
+			})
+		}
+	})
+	t.Run("should identify the resolved resource on failure", func(t *testing.T) {
+		// given
+		sut, apiInterfaceMock := newMappedApplier(t, testServiceAccountMapping, "mynamespace")
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "the-best-resource-in-store", metav1.GetOptions{}).
+			Return(nil, k8serrors.NewNotFound(schema.GroupResource{}, "the-best-resource-in-store"))
+		apiInterfaceMock.EXPECT().Patch(mock.Anything, "the-best-resource-in-store", types.ApplyPatchType, mock.Anything, mock.Anything).
+			Return(nil, assert.AnError)
+
+		testResource := []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: the-best-resource-in-store
+  namespace: declared`)
+
+		// when
+		actual, err := sut.ApplyWithOptions(context.Background(), testResource, "mynamespace", ApplyOptions{})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		require.NotNil(t, actual)
+		assert.Nil(t, actual.Object)
+		assert.Equal(t, testServiceAccountMapping.GroupVersionKind, actual.GroupVersionKind)
+		assert.Equal(t, "mynamespace", actual.Namespace)
+		assert.Equal(t, "the-best-resource-in-store", actual.Name)
+	})
+}
+
+func Test_applyOperation(t *testing.T) {
+	live := &unstructured.Unstructured{Object: map[string]interface{}{"data": map[string]interface{}{"key": "value"}}}
+	live.SetResourceVersion("1")
+	changed := &unstructured.Unstructured{Object: map[string]interface{}{"data": map[string]interface{}{"key": "other"}}}
+	changed.SetResourceVersion("1")
+
+	t.Run("should compare the resources during a dry-run", func(t *testing.T) {
+		assert.Equal(t, ApplyOperationUnchanged, applyOperation(live, live.DeepCopy(), true))
+		assert.Equal(t, ApplyOperationConfigured, applyOperation(live, changed, true))
+		assert.Equal(t, ApplyOperationCreated, applyOperation(nil, changed, true))
+	})
+}
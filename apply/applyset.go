@@ -0,0 +1,207 @@
+package apply
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// The following labels and annotations follow the ApplySet specification of KEP-3659 so that apply sets created by
+// this library can be inspected with kubectl. See also: https://github.com/kubernetes/enhancements/tree/master/keps/sig-cli/3659-kubectl-apply-prune
+const (
+	// ApplySetPartOfLabel marks a resource as member of the apply set with the label's value as ID.
+	ApplySetPartOfLabel = "applyset.kubernetes.io/part-of"
+	// ApplySetParentIDLabel marks the parent resource of the apply set with the label's value as ID.
+	ApplySetParentIDLabel = "applyset.kubernetes.io/id"
+	// ApplySetToolingAnnotation names the tool which manages the apply set.
+	ApplySetToolingAnnotation = "applyset.kubernetes.io/tooling"
+	// ApplySetGroupKindsAnnotation lists the group kinds of all apply set members on the parent resource.
+	ApplySetGroupKindsAnnotation = "applyset.kubernetes.io/contains-group-kinds"
+	// ApplySetAdditionalNamespacesAnnotation lists the namespaces of apply set members besides the namespace of the
+	// parent resource.
+	ApplySetAdditionalNamespacesAnnotation = "applyset.kubernetes.io/additional-namespaces"
+)
+
+const applySetTooling = "k8s-apply-lib/v1"
+
+// applySetParentKind is the kind of the resource which represents an apply set in the cluster. kubectl uses Secrets by
+// default as well.
+var applySetParentKind = schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+
+// ApplySetID returns the ID of the apply set which is represented by the parent resource with the given name,
+// namespace, kind and group.
+func ApplySetID(parentName, parentNamespace, parentKind, parentGroup string) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s.%s.%s.%s", parentName, parentNamespace, parentKind, parentGroup)))
+	return fmt.Sprintf("applyset-%s-v1", base64.RawURLEncoding.EncodeToString(hash[:]))
+}
+
+// PruneOptions contains settings which control which resources are deleted by Applier.Prune.
+type PruneOptions struct {
+	// AllowList contains the kinds of resources which may be pruned. Resources of other kinds are never deleted.
+	AllowList []schema.GroupVersionKind
+	// Namespaces contains the namespaces which are searched for namespaced resources.
+	Namespaces []string
+	// Keep returns true for resources which are still part of the apply set and must not be deleted.
+	Keep func(resource *unstructured.Unstructured) bool
+	// DryRun sends the deletions as server-side dry-run.
+	DryRun bool
+}
+
+// Prune deletes all resources that carry the apply set label with the given ID but are not kept by
+// PruneOptions.Keep. Only resources of the allow-listed kinds are considered. The deleted resources are returned.
+func (ac *Applier) Prune(ctx context.Context, applySetID string, opts PruneOptions) ([]*unstructured.Unstructured, error) {
+	selector := labels.SelectorFromSet(labels.Set{ApplySetPartOfLabel: applySetID}).String()
+	pruned := make([]*unstructured.Unstructured, 0)
+
+	for _, gvk := range opts.AllowList {
+		mapping, err := ac.restMapping(ctx, gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return pruned, fmt.Errorf("could not find GVK mapper for GroupKind=%v,Version=%s while pruning: %w", gvk.GroupKind(), gvk.Version, err)
+		}
+
+		for _, dr := range ac.pruneTargets(mapping, opts.Namespaces) {
+			deleted, err := ac.pruneResources(ctx, dr, selector, opts)
+			pruned = append(pruned, deleted...)
+			if err != nil {
+				return pruned, err
+			}
+		}
+	}
+
+	return pruned, nil
+}
+
+func (ac *Applier) pruneTargets(mapping *meta.RESTMapping, namespaces []string) []dynamic.ResourceInterface {
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return []dynamic.ResourceInterface{ac.dynClient.Resource(mapping.Resource)}
+	}
+
+	targets := make([]dynamic.ResourceInterface, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		targets = append(targets, ac.dynClient.Resource(mapping.Resource).Namespace(namespace))
+	}
+
+	return targets
+}
+
+func (ac *Applier) pruneResources(ctx context.Context, dr dynamic.ResourceInterface, selector string, opts PruneOptions) ([]*unstructured.Unstructured, error) {
+	list, err := dr.List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("could not list apply set members with selector %s: %w", selector, err)
+	}
+
+	deleteOptions := metav1.DeleteOptions{}
+	if opts.DryRun {
+		deleteOptions.DryRun = []string{metav1.DryRunAll}
+	}
+
+	pruned := make([]*unstructured.Unstructured, 0)
+	for i := range list.Items {
+		resource := &list.Items[i]
+		if opts.Keep != nil && opts.Keep(resource) {
+			continue
+		}
+
+		ac.log().Debug(fmt.Sprintf("Pruning resource %s/%s/%s", resource.GetKind(), resource.GetAPIVersion(), resource.GetName()))
+		err = dr.Delete(ctx, resource.GetName(), deleteOptions)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return pruned, NewResourceError(err, "error while pruning", resource.GetKind(), resource.GetAPIVersion(), resource.GetName())
+		}
+
+		pruned = append(pruned, resource)
+	}
+
+	return pruned, nil
+}
+
+// ApplySetNamespaces returns the namespaces of the apply set members which are recorded on the parent resource with
+// the given name and namespace. The result always contains the namespace of the parent, even if the parent does not
+// exist yet.
+func (ac *Applier) ApplySetNamespaces(ctx context.Context, parentName, parentNamespace string) ([]string, error) {
+	mapping, err := ac.restMapping(ctx, applySetParentKind.GroupKind(), applySetParentKind.Version)
+	if err != nil {
+		return nil, fmt.Errorf("could not find GVK mapper for GroupKind=%v,Version=%s while reading apply set parent: %w", applySetParentKind.GroupKind(), applySetParentKind.Version, err)
+	}
+
+	namespaces := sets.New(parentNamespace)
+	parent, err := ac.dynClient.Resource(mapping.Resource).Namespace(parentNamespace).Get(ctx, parentName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return sets.List(namespaces), nil
+	}
+	if err != nil {
+		return nil, NewResourceError(err, "error while reading apply set parent", applySetParentKind.Kind, applySetParentKind.GroupVersion().String(), parentName)
+	}
+
+	for _, namespace := range strings.Split(parent.GetAnnotations()[ApplySetAdditionalNamespacesAnnotation], ",") {
+		if namespace != "" {
+			namespaces.Insert(namespace)
+		}
+	}
+
+	return sets.List(namespaces), nil
+}
+
+// applySetParentDocument creates the parent resource of an apply set which lists the given group kinds and the
+// namespaces of its members.
+func applySetParentDocument(name, namespace string, groupKinds []schema.GroupKind, namespaces []string) (YamlDocument, error) {
+	kinds := sets.New[string]()
+	for _, gk := range groupKinds {
+		kinds.Insert(gk.String())
+	}
+	additionalNamespaces := sets.New(namespaces...).Delete(namespace, "")
+
+	parent := &unstructured.Unstructured{}
+	parent.SetGroupVersionKind(applySetParentKind)
+	parent.SetName(name)
+	parent.SetNamespace(namespace)
+	parent.SetLabels(map[string]string{
+		ApplySetParentIDLabel: ApplySetID(name, namespace, applySetParentKind.Kind, applySetParentKind.Group),
+	})
+	parent.SetAnnotations(map[string]string{
+		ApplySetToolingAnnotation:    applySetTooling,
+		ApplySetGroupKindsAnnotation: strings.Join(sets.List(kinds), ","),
+	})
+	if additionalNamespaces.Len() > 0 {
+		annotations := parent.GetAnnotations()
+		annotations[ApplySetAdditionalNamespacesAnnotation] = strings.Join(sets.List(additionalNamespaces), ",")
+		parent.SetAnnotations(annotations)
+	}
+
+	doc, err := yaml.Marshal(parent.Object)
+	if err != nil {
+		return nil, fmt.Errorf("could not create apply set parent %s/%s: %w", namespace, name, err)
+	}
+
+	return doc, nil
+}
+
+// applySetKeepFunc keeps all resources which were applied during the current run or which match a document that was
+// skipped by an ApplyFilter. The latter are identified by group, kind and name because their UID is unknown.
+func applySetKeepFunc(applied []DocumentResult, skipped []*documentHeader) func(resource *unstructured.Unstructured) bool {
+	appliedUIDs := sets.New[string]()
+	for _, doc := range applied {
+		appliedUIDs.Insert(string(doc.Object.GetUID()))
+	}
+
+	skippedKeys := sets.New[string]()
+	for _, header := range skipped {
+		skippedKeys.Insert(header.groupKind().String() + "/" + header.Metadata.Name)
+	}
+
+	return func(resource *unstructured.Unstructured) bool {
+		key := resource.GroupVersionKind().GroupKind().String() + "/" + resource.GetName()
+		return appliedUIDs.Has(string(resource.GetUID())) || skippedKeys.Has(key)
+	}
+}
@@ -0,0 +1,252 @@
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	testApplySetName = "le-apply-set"
+	testApplySetID   = "applyset-rQaCBtgx3TZvbOHw5W7HN1TDhy-ZmnPB8brNF5VvRws-v1"
+)
+
+func TestApplySetID(t *testing.T) {
+	t.Run("should compute the ID according to the ApplySet specification", func(t *testing.T) {
+		actual := ApplySetID(testApplySetName, testNamespace, "Secret", "")
+
+		assert.Equal(t, testApplySetID, actual)
+	})
+}
+
+func Test_applySetParentDocument(t *testing.T) {
+	t.Run("should create a labelled Secret listing all group kinds once", func(t *testing.T) {
+		// given
+		groupKinds := []schema.GroupKind{
+			{Group: "apps", Kind: "Deployment"},
+			{Kind: "ServiceAccount"},
+			{Group: "apps", Kind: "Deployment"},
+		}
+
+		// when
+		actual, err := applySetParentDocument(testApplySetName, testNamespace, groupKinds, []string{testNamespace})
+
+		// then
+		require.NoError(t, err)
+		parent := &unstructured.Unstructured{}
+		require.NoError(t, yaml.Unmarshal(actual, &parent.Object))
+		assert.Equal(t, "Secret", parent.GetKind())
+		assert.Equal(t, testApplySetName, parent.GetName())
+		assert.Equal(t, testNamespace, parent.GetNamespace())
+		assert.Equal(t, map[string]string{ApplySetParentIDLabel: testApplySetID}, parent.GetLabels())
+		assert.Equal(t, map[string]string{
+			ApplySetToolingAnnotation:    "k8s-apply-lib/v1",
+			ApplySetGroupKindsAnnotation: "Deployment.apps,ServiceAccount",
+		}, parent.GetAnnotations())
+	})
+	t.Run("should list the namespaces besides the parent's namespace", func(t *testing.T) {
+		// when
+		actual, err := applySetParentDocument(testApplySetName, testNamespace, nil, []string{"second", testNamespace, "first", ""})
+
+		// then
+		require.NoError(t, err)
+		parent := &unstructured.Unstructured{}
+		require.NoError(t, yaml.Unmarshal(actual, &parent.Object))
+		assert.Equal(t, "first,second", parent.GetAnnotations()[ApplySetAdditionalNamespacesAnnotation])
+	})
+}
+
+func TestApplier_ApplySetNamespaces(t *testing.T) {
+	secretMapping := &meta.RESTMapping{
+		Resource:         schema.GroupVersionResource{Version: "v1", Resource: "secrets"},
+		GroupVersionKind: applySetParentKind,
+		Scope:            meta.RESTScopeNamespace,
+	}
+	newSut := func(t *testing.T, parent *unstructured.Unstructured, err error) *Applier {
+		sut, apiInterfaceMock := newMappedApplier(t, secretMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, testApplySetName, metav1.GetOptions{}).Return(parent, err)
+
+		return sut
+	}
+
+	t.Run("should return the parent's and the additional namespaces", func(t *testing.T) {
+		// given
+		parent := &unstructured.Unstructured{}
+		parent.SetAnnotations(map[string]string{ApplySetAdditionalNamespacesAnnotation: "second,first"})
+		sut := newSut(t, parent, nil)
+
+		// when
+		actual, err := sut.ApplySetNamespaces(context.Background(), testApplySetName, testNamespace)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []string{"first", testNamespace, "second"}, actual)
+	})
+	t.Run("should return the parent's namespace if the parent does not exist", func(t *testing.T) {
+		// given
+		sut := newSut(t, nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, testApplySetName))
+
+		// when
+		actual, err := sut.ApplySetNamespaces(context.Background(), testApplySetName, testNamespace)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []string{testNamespace}, actual)
+	})
+	t.Run("should fail to read the parent", func(t *testing.T) {
+		// given
+		sut := newSut(t, nil, assert.AnError)
+
+		// when
+		_, err := sut.ApplySetNamespaces(context.Background(), testApplySetName, testNamespace)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "error while reading apply set parent")
+	})
+}
+
+func newApplySetMember(uid, name string) unstructured.Unstructured {
+	member := unstructured.Unstructured{}
+	member.SetAPIVersion("v1")
+	member.SetKind("ConfigMap")
+	member.SetName(name)
+	member.SetUID(types.UID(uid))
+	return member
+}
+
+func TestApplier_Prune(t *testing.T) {
+	configMapMapping := &meta.RESTMapping{
+		Resource:         schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+		Scope:            meta.RESTScopeNamespace,
+	}
+	expectedListOptions := metav1.ListOptions{LabelSelector: ApplySetPartOfLabel + "=" + testApplySetID}
+
+	t.Run("should delete members which are not kept in every namespace", func(t *testing.T) {
+		// given
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().RESTMapping(schema.GroupKind{Kind: "ConfigMap"}, "v1").Return(configMapMapping, nil)
+
+		firstNamespaceMock := newMockNamespaceInterface(t)
+		firstNamespaceMock.EXPECT().List(mock.Anything, expectedListOptions).Return(&unstructured.UnstructuredList{
+			Items: []unstructured.Unstructured{newApplySetMember("1", "kept"), newApplySetMember("2", "removed")},
+		}, nil)
+		firstNamespaceMock.EXPECT().Delete(mock.Anything, "removed", metav1.DeleteOptions{}).Return(nil)
+		secondNamespaceMock := newMockNamespaceInterface(t)
+		secondNamespaceMock.EXPECT().List(mock.Anything, expectedListOptions).Return(&unstructured.UnstructuredList{
+			Items: []unstructured.Unstructured{newApplySetMember("3", "already-gone")},
+		}, nil)
+		notFound := k8serrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "already-gone")
+		secondNamespaceMock.EXPECT().Delete(mock.Anything, "already-gone", metav1.DeleteOptions{}).Return(notFound)
+
+		resourceMock := newMockNamespaceInterface(t)
+		resourceMock.EXPECT().Namespace("first").Return(firstNamespaceMock)
+		resourceMock.EXPECT().Namespace("second").Return(secondNamespaceMock)
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(configMapMapping.Resource).Return(resourceMock)
+
+		sut := &Applier{gvrMapper: gvrMapperMock, dynClient: dynClientMock}
+
+		// when
+		actual, err := sut.Prune(context.Background(), testApplySetID, PruneOptions{
+			AllowList:  []schema.GroupVersionKind{configMapMapping.GroupVersionKind},
+			Namespaces: []string{"first", "second"},
+			Keep: func(resource *unstructured.Unstructured) bool {
+				return resource.GetUID() == "1"
+			},
+		})
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, actual, 2)
+		assert.Equal(t, "removed", actual[0].GetName())
+		assert.Equal(t, "already-gone", actual[1].GetName())
+	})
+	t.Run("should send deletions as dry-run", func(t *testing.T) {
+		// given
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().RESTMapping(schema.GroupKind{Kind: "ConfigMap"}, "v1").Return(configMapMapping, nil)
+
+		namespaceMock := newMockNamespaceInterface(t)
+		namespaceMock.EXPECT().List(mock.Anything, expectedListOptions).Return(&unstructured.UnstructuredList{
+			Items: []unstructured.Unstructured{newApplySetMember("2", "removed")},
+		}, nil)
+		namespaceMock.EXPECT().Delete(mock.Anything, "removed", metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}}).Return(nil)
+		resourceMock := newMockNamespaceInterface(t)
+		resourceMock.EXPECT().Namespace(testNamespace).Return(namespaceMock)
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(configMapMapping.Resource).Return(resourceMock)
+
+		sut := &Applier{gvrMapper: gvrMapperMock, dynClient: dynClientMock}
+
+		// when
+		actual, err := sut.Prune(context.Background(), testApplySetID, PruneOptions{
+			AllowList:  []schema.GroupVersionKind{configMapMapping.GroupVersionKind},
+			Namespaces: []string{testNamespace},
+			DryRun:     true,
+		})
+
+		// then
+		require.NoError(t, err)
+		assert.Len(t, actual, 1)
+	})
+	t.Run("should fail to delete a member", func(t *testing.T) {
+		// given
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().RESTMapping(schema.GroupKind{Kind: "ConfigMap"}, "v1").Return(configMapMapping, nil)
+
+		namespaceMock := newMockNamespaceInterface(t)
+		namespaceMock.EXPECT().List(mock.Anything, expectedListOptions).Return(&unstructured.UnstructuredList{
+			Items: []unstructured.Unstructured{newApplySetMember("2", "removed")},
+		}, nil)
+		namespaceMock.EXPECT().Delete(mock.Anything, "removed", mock.Anything).Return(assert.AnError)
+		resourceMock := newMockNamespaceInterface(t)
+		resourceMock.EXPECT().Namespace(testNamespace).Return(namespaceMock)
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(configMapMapping.Resource).Return(resourceMock)
+
+		sut := &Applier{gvrMapper: gvrMapperMock, dynClient: dynClientMock}
+
+		// when
+		_, err := sut.Prune(context.Background(), testApplySetID, PruneOptions{
+			AllowList:  []schema.GroupVersionKind{configMapMapping.GroupVersionKind},
+			Namespaces: []string{testNamespace},
+		})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "error while pruning")
+	})
+}
+
+func Test_applySetKeepFunc(t *testing.T) {
+	t.Run("should keep applied and skipped resources", func(t *testing.T) {
+		// given
+		applied := newApplySetMember("1", "applied")
+		skipped := &documentHeader{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}}
+		skipped.Metadata.Name = "skipped"
+		removed := newApplySetMember("3", "removed")
+		skippedMember := newApplySetMember("2", "skipped")
+
+		// when
+		sut := applySetKeepFunc([]DocumentResult{{ResourceResult: ResourceResult{Object: &applied}}}, []*documentHeader{skipped})
+
+		// then
+		assert.True(t, sut(&applied))
+		assert.True(t, sut(&skippedMember))
+		assert.False(t, sut(&removed))
+	})
+}
@@ -2,10 +2,17 @@ package apply
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"text/template"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 type applier interface {
@@ -13,6 +20,44 @@ type applier interface {
 	ApplyWithOwner(doc YamlDocument, namespace string, resource metav1.Object) error
 }
 
+// The following interfaces contain optional methods of an applier which are implemented by Applier. A Builder with an
+// applier which lacks one of them fails with an error once a feature requires it.
+type (
+	optionsApplier interface {
+		// ApplyWithOptions provides a testable method
+		ApplyWithOptions(ctx context.Context, doc YamlDocument, namespace string, opts ApplyOptions) (*ResourceResult, error)
+	}
+	differ interface {
+		// Diff provides a testable method
+		Diff(ctx context.Context, doc YamlDocument, namespace string, opts ApplyOptions) (*ResourceDiff, error)
+	}
+	pruner interface {
+		// Prune provides a testable method
+		Prune(ctx context.Context, applySetID string, opts PruneOptions) ([]*unstructured.Unstructured, error)
+		// ApplySetNamespaces provides a testable method
+		ApplySetNamespaces(ctx context.Context, parentName, parentNamespace string) ([]string, error)
+	}
+	inventoryReader interface {
+		// ReadInventory provides a testable method
+		ReadInventory(ctx context.Context, target InventoryTarget) (*Inventory, error)
+		// ResolveInventoryEntry provides a testable method
+		ResolveInventoryEntry(ctx context.Context, doc YamlDocument, namespace string, opts ApplyOptions) (InventoryEntry, error)
+	}
+	deleter interface {
+		// DeleteContext provides a testable method
+		DeleteContext(ctx context.Context, doc YamlDocument, namespace string, opts DeleteOptions) error
+	}
+	readinessWaiter interface {
+		// WaitForReady provides a testable method
+		WaitForReady(ctx context.Context, resources []*unstructured.Unstructured, opts WaitOptions) ([]ResourceStatus, error)
+	}
+)
+
+// errUnsupportedApplier returns the error for an applier which lacks the given method.
+func errUnsupportedApplier(a applier, method string) error {
+	return fmt.Errorf("applier %T does not implement %s which is required by the configured Builder features", a, method)
+}
+
 // PredicatedResourceCollector help to identify and collect specific Kubernetes resources that stream through the
 // applier. It is the implementor's task to provide both the predicate to match the resource and to handle the resource
 // collection. The collected resources can be fetched after the Applier/Builder finished applying the resources to the
@@ -69,12 +114,30 @@ type ApplyFilter interface {
 //	   ExecuteApply()
 type Builder struct {
 	applier               applier
+	fileOrder             []string
 	fileToGenericResource map[string][]byte
 	fileToTemplate        map[string]interface{}
+	renderedFiles         map[string]bool
+	fileToHelmRelease     map[string]*helmRelease
 	owningResource        metav1.Object
+	ownerReferences       []OwnerReference
 	namespace             string
+	namespacePolicy       NamespacePolicy
 	predicatedCollectors  []PredicatedResourceCollector
 	applyFilter           ApplyFilter
+	dryRun                bool
+	applySetName          string
+	pruneAllowList        []schema.GroupVersionKind
+	inventoryTarget       *InventoryTarget
+	deletePropagation     metav1.DeletionPropagation
+	waitTimeout           time.Duration
+	concurrency           int
+	continueOnError       bool
+	fileToRenderer        map[string]TemplateRenderer
+	goTemplateRenderer    GoTemplateRenderer
+	loadErrors            []error
+	// callbackMutex serializes calls of collectors and filters during concurrent applies.
+	callbackMutex sync.Mutex
 }
 
 // NewBuilder creates a new builder.
@@ -83,20 +146,81 @@ func NewBuilder(applier applier) *Builder {
 		applier:               applier,
 		fileToGenericResource: make(map[string][]byte),
 		fileToTemplate:        make(map[string]interface{}),
+		renderedFiles:         make(map[string]bool),
+		fileToHelmRelease:     make(map[string]*helmRelease),
+		fileToRenderer:        make(map[string]TemplateRenderer),
 		predicatedCollectors:  []PredicatedResourceCollector{},
 	}
 }
 
-// WithYamlResource adds another YAML resource to the builder.
+// WithYamlResource adds another YAML resource to the builder. Resources of the same kind are applied in the order in
+// which their files were added. Adding a file again replaces its content but keeps its position.
 func (ab *Builder) WithYamlResource(filename string, yamlResource []byte) *Builder {
+	if !ab.hasFile(filename) {
+		ab.fileOrder = append(ab.fileOrder, filename)
+	}
 	ab.fileToGenericResource[filename] = yamlResource
+	delete(ab.renderedFiles, filename)
+	delete(ab.fileToHelmRelease, filename)
 
 	return ab
 }
 
-// WithTemplate adds templating features to the YAML resource with the given filename. This method is optional.
-func (ab *Builder) WithTemplate(filename string, templateObject interface{}) *Builder {
+func (ab *Builder) hasFile(filename string) bool {
+	_, isResource := ab.fileToGenericResource[filename]
+	_, isHelmRelease := ab.fileToHelmRelease[filename]
+
+	return isResource || isHelmRelease
+}
+
+// withRenderedResource adds a resource which was generated by a renderer like Kustomize. Such resources are
+// never rendered as template again, even if other files use WithTemplate.
+func (ab *Builder) withRenderedResource(filename string, yamlResource []byte) *Builder {
+	ab.WithYamlResource(filename, yamlResource)
+	ab.renderedFiles[filename] = true
+
+	return ab
+}
+
+// WithTemplate adds templating features to the YAML resource with the given filename. The file is rendered as Go
+// template unless another TemplateRenderer like EnvsubstRenderer is passed. This method is optional.
+func (ab *Builder) WithTemplate(filename string, templateObject interface{}, renderer ...TemplateRenderer) *Builder {
 	ab.fileToTemplate[filename] = templateObject
+	if len(renderer) > 0 {
+		ab.fileToRenderer[filename] = renderer[0]
+	}
+
+	return ab
+}
+
+// WithTemplateFuncs adds functions which can be called from all templates. Besides these functions, templates may use
+// a built-in library of Sprig-compatible functions like default, quote, b64enc, indent, nindent and required as well
+// as toYaml, fromYaml, include and tpl known from Helm. Functions added here replace built-in functions of the same
+// name. This method is optional.
+func (ab *Builder) WithTemplateFuncs(funcs template.FuncMap) *Builder {
+	if ab.goTemplateRenderer.Funcs == nil {
+		ab.goTemplateRenderer.Funcs = template.FuncMap{}
+	}
+	for name, fn := range funcs {
+		ab.goTemplateRenderer.Funcs[name] = fn
+	}
+
+	return ab
+}
+
+// WithTemplateDelimiters sets the action delimiters of all templates, f. i. to render manifests which contain
+// "{{" themselves. Empty delimiters default to "{{" and "}}". This method is optional.
+func (ab *Builder) WithTemplateDelimiters(left, right string) *Builder {
+	ab.goTemplateRenderer.LeftDelim = left
+	ab.goTemplateRenderer.RightDelim = right
+
+	return ab
+}
+
+// WithStrictTemplates makes rendering fail if a template accesses a missing map key instead of rendering
+// "<no value>". This method is optional.
+func (ab *Builder) WithStrictTemplates() *Builder {
+	ab.goTemplateRenderer.Strict = true
 
 	return ab
 }
@@ -109,13 +233,32 @@ func (ab *Builder) WithOwner(owningResource metav1.Object) *Builder {
 	return ab
 }
 
-// WithNamespace sets the target namespace to which the file's resources will apply. This method is mandatory.
+// WithOwnerReference adds another owner of the resources which are applied during ExecuteApply. Other than WithOwner,
+// this method may be called several times, but only one owner can be the controller. Controller ownership fails with
+// an AlreadyOwnedError if another controller manages a resource already. This method is optional.
+func (ab *Builder) WithOwnerReference(owner metav1.Object, controller bool, blockOwnerDeletion bool) *Builder {
+	ab.ownerReferences = append(ab.ownerReferences, OwnerReference{Owner: owner, Controller: controller, BlockOwnerDeletion: blockOwnerDeletion})
+
+	return ab
+}
+
+// WithNamespace sets the target namespace to which the file's resources will apply. This method is mandatory unless
+// NamespacePolicyDefault is used and all namespaced resources declare their namespace.
 func (ab *Builder) WithNamespace(namespace string) *Builder {
 	ab.namespace = namespace
 
 	return ab
 }
 
+// WithNamespacePolicy sets how the namespace of WithNamespace is combined with namespaces declared in the documents.
+// Without a policy, the policy of the Applier is used which defaults to NamespacePolicyEnforce. Use
+// NamespacePolicyDefault to apply documents to several namespaces in one run. This method is optional.
+func (ab *Builder) WithNamespacePolicy(policy NamespacePolicy) *Builder {
+	ab.namespacePolicy = policy
+
+	return ab
+}
+
 // WithCollector adds the given PredicatedResourceCollector to list of collectors. This method is optional.
 func (ab *Builder) WithCollector(collector PredicatedResourceCollector) *Builder {
 	ab.predicatedCollectors = append(ab.predicatedCollectors, collector)
@@ -131,97 +274,700 @@ func (ab *Builder) WithApplyFilter(filter ApplyFilter) *Builder {
 	return ab
 }
 
+// WithDryRun sends all resources as server-side dry-run during ExecuteApply. The API server runs admission webhooks,
+// schema validation and quota checks as usual but does not persist anything. Use ExecuteApplyWithResult to fetch the
+// server-computed resources. This method is optional.
+func (ab *Builder) WithDryRun() *Builder {
+	ab.dryRun = true
+
+	return ab
+}
+
+// WithPrune enables pruning of resources which were removed from the manifests. Every applied resource is labelled as
+// member of an apply set, which is represented by a Secret with the given name in the builder's namespace. After all
+// resources were applied successfully, members of the apply set which were not part of the current run are deleted.
+// Only resources of the allow-listed kinds are pruned. Resources skipped by an ApplyFilter are never pruned. The apply
+// set follows the kubectl ApplySet specification. This method is optional.
+func (ab *Builder) WithPrune(applySetName string, allowList ...schema.GroupVersionKind) *Builder {
+	ab.applySetName = applySetName
+	ab.pruneAllowList = allowList
+
+	return ab
+}
+
+// WithInventory records every resource which was applied during ExecuteApply in the given target resource, f. i. a
+// ConfigMap created with ConfigMapInventory. The inventory can be compared with the current manifests by
+// CompareInventory. This method is optional.
+func (ab *Builder) WithInventory(target InventoryTarget) *Builder {
+	ab.inventoryTarget = &target
+
+	return ab
+}
+
+// WithDeletePropagation sets the propagation policy which is used during ExecuteDelete. The API server's default policy
+// is used if it is not set. This method is optional.
+func (ab *Builder) WithDeletePropagation(policy metav1.DeletionPropagation) *Builder {
+	ab.deletePropagation = policy
+
+	return ab
+}
+
+// WithWait makes ExecuteApply watch all applied resources until they are ready or the given timeout is exceeded.
+// Deployments, StatefulSets and DaemonSets must have completed their rollout, Jobs must have succeeded, CRDs must be
+// established and PersistentVolumeClaims must be bound. Other resources must report a true Ready condition if they
+// have any. If not all resources become ready, ExecuteApply returns a *WaitError which names the unready resources.
+// Waiting is skipped during a dry-run. This method is optional.
+func (ab *Builder) WithWait(timeout time.Duration) *Builder {
+	ab.waitTimeout = timeout
+
+	return ab
+}
+
+// WithConcurrency applies up to n documents at the same time during ExecuteApply. Only documents of the same ordering
+// tier, i. e. documents whose kinds have the same install priority, are applied concurrently, so that f. i. namespaces
+// still exist before the resources inside them are applied. Collectors and the ApplyFilter are never called
+// concurrently. If documents fail, the errors of all failed documents of a tier are joined in document order. Values
+// below 2 apply documents sequentially, which is the default. This method is optional.
+func (ab *Builder) WithConcurrency(n int) *Builder {
+	ab.concurrency = n
+
+	return ab
+}
+
+// WithContinueOnError makes ExecuteApply apply all documents even if some of them fail. Afterwards an *ApplyErrors
+// is returned which contains one ResourceError per failed document. Pruning and writing the inventory are skipped if
+// documents failed, so that resources are not deleted just because their update failed. Cancellation still stops the
+// run immediately. This method is optional.
+func (ab *Builder) WithContinueOnError() *Builder {
+	ab.continueOnError = true
+
+	return ab
+}
+
 // ExecuteApply executes applies pending template renderings to the cumulated resources, collects resources for any
 // configured collectors, and applies the result against the configured Kubernetes API.
+//
+// Documents are applied in dependency order of their kinds, similar to Helm and kubectl: namespaces, CRDs, service
+// accounts, RBAC, config maps and secrets, services, workloads and finally webhooks. Documents of the same kind keep
+// the order in which their files were added by WithYamlResource.
 func (ab *Builder) ExecuteApply() error {
-	err := ab.renderTemplates()
+	return ab.ExecuteApplyContext(context.Background())
+}
+
+// ExecuteApplyContext works like ExecuteApply but aborts once the given context is cancelled or exceeds its deadline.
+// Documents are never applied partially: the context is checked between documents and passed to every API request.
+// If the run is interrupted the returned error is an *UnappliedDocumentsError which lists the documents that were left
+// unapplied.
+func (ab *Builder) ExecuteApplyContext(ctx context.Context) error {
+	_, err := ab.ExecuteApplyWithResult(ctx)
+	return err
+}
+
+// ExecuteApplyWithResult works like ExecuteApplyContext and additionally returns the resources as they were computed
+// by the Kubernetes API. In case of an error the result contains all documents which were applied up to this point.
+func (ab *Builder) ExecuteApplyWithResult(ctx context.Context) (*ApplyResult, error) {
+	result := &ApplyResult{}
+
+	err := ab.checkApplyFeatures()
 	if err != nil {
-		return err
+		return result, err
+	}
+
+	docs, err := ab.documents()
+	if err != nil {
+		return result, err
 	}
 
-	fileToSingleYamlDocs := ab.splitYamlDocs()
+	docs, err = sortDocumentsByKind(docs, false)
+	if err != nil {
+		return result, err
+	}
 
-	for filename, yamlDocs := range fileToSingleYamlDocs {
-		for _, yamlDoc := range yamlDocs {
-			if err := ab.applyDoc(filename, yamlDoc); err != nil {
-				return err
+	var parent *applySetParent
+	if ab.applySetName != "" {
+		parent, err = ab.applyApplySetParent(ctx, docs)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	var mutex sync.Mutex
+	var skipped []*documentHeader
+	applied := make(map[DocumentReference]*ResourceResult, len(docs))
+	failed := make(map[DocumentReference]*ResourceError)
+	err = ab.processApplyDocuments(ctx, docs, func(ctx context.Context, doc sourceDocument) error {
+		appliedResource, ok, err := ab.applyDoc(ctx, doc.Filename, doc.doc)
+		if err != nil && (!ab.continueOnError || isContextError(err)) {
+			return err
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err != nil {
+			failed[doc.DocumentReference] = newDocumentError(err, doc, appliedResource, ab.errorNamespace)
+			return nil
+		}
+		if !ok {
+			if ab.applySetName != "" {
+				header, err := parseDocumentHeader(doc.doc)
+				if err != nil {
+					return err
+				}
+				skipped = append(skipped, header)
 			}
+			return nil
+		}
+
+		applied[doc.DocumentReference] = appliedResource
+		return nil
+	})
+	// documents are listed in order of application even if they were applied concurrently
+	applyErrs := &ApplyErrors{}
+	for _, doc := range docs {
+		if appliedResource, ok := applied[doc.DocumentReference]; ok {
+			result.Documents = append(result.Documents, DocumentResult{DocumentReference: doc.DocumentReference, ResourceResult: *appliedResource})
+		}
+		if docErr, ok := failed[doc.DocumentReference]; ok {
+			applyErrs.errs = append(applyErrs.errs, docErr)
+		}
+	}
+	switch {
+	case err != nil && len(applyErrs.errs) > 0:
+		return result, errors.Join(applyErrs, err)
+	case err != nil:
+		return result, err
+	case len(applyErrs.errs) > 0:
+		return result, applyErrs
+	}
+
+	if parent != nil {
+		result.Pruned, err = ab.prune(ctx, parent, result.Documents, skipped)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if ab.inventoryTarget != nil {
+		err = ab.writeInventory(ctx, result.Documents)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if ab.waitTimeout > 0 && !ab.dryRun {
+		result.Statuses, err = ab.waitForReady(ctx, result.Documents)
+	}
+
+	return result, err
+}
+
+// checkApplyFeatures fails if the applier lacks methods which are required by the configured features, so that an
+// apply does not fail halfway.
+func (ab *Builder) checkApplyFeatures() error {
+	if ab.applySetName != "" {
+		if _, ok := ab.applier.(pruner); !ok {
+			return errUnsupportedApplier(ab.applier, "Prune")
+		}
+	}
+	if ab.waitTimeout > 0 && !ab.dryRun {
+		if _, ok := ab.applier.(readinessWaiter); !ok {
+			return errUnsupportedApplier(ab.applier, "WaitForReady")
 		}
 	}
 
 	return nil
 }
 
-func (ab *Builder) applyDoc(filename string, yamlDoc YamlDocument) error {
-	err := ab.runCollectors(yamlDoc)
+func (ab *Builder) waitForReady(ctx context.Context, applied []DocumentResult) ([]ResourceStatus, error) {
+	resources := make([]*unstructured.Unstructured, 0, len(applied))
+	for _, doc := range applied {
+		if doc.Object != nil {
+			resources = append(resources, doc.Object)
+		}
+	}
+
+	waiter, ok := ab.applier.(readinessWaiter)
+	if !ok {
+		return nil, errUnsupportedApplier(ab.applier, "WaitForReady")
+	}
+
+	statuses, err := waiter.WaitForReady(ctx, resources, WaitOptions{Timeout: ab.waitTimeout})
+	if err != nil {
+		return statuses, fmt.Errorf("waiting for applied resources failed: %w", err)
+	}
+
+	return statuses, nil
+}
+
+func (ab *Builder) writeInventory(ctx context.Context, applied []DocumentResult) error {
+	inventory := &Inventory{Entries: make([]InventoryEntry, 0, len(applied))}
+	for _, doc := range applied {
+		if doc.Object != nil {
+			inventory.Entries = append(inventory.Entries, newInventoryEntry(doc.Object))
+		}
+	}
+
+	inventoryDoc, err := inventoryDocument(*ab.inventoryTarget, inventory)
 	if err != nil {
-		return fmt.Errorf("resource collection failed for file %s: %w", filename, err)
+		return err
 	}
 
-	if ab.applyFilter != nil {
-		ok, err := ab.applyFilter.Predicate(yamlDoc)
+	_, err = ab.applyWithOptions(ctx, inventoryDoc, ab.inventoryTarget.Namespace, ApplyOptions{DryRun: ab.dryRun})
+	if err != nil {
+		return fmt.Errorf("could not write inventory to %s: %w", *ab.inventoryTarget, err)
+	}
+
+	return nil
+}
+
+// CompareInventory reads the inventory configured by WithInventory and compares it with the resources of the current
+// manifests. Templates are rendered and the ApplyFilter is respected, but nothing is applied.
+func (ab *Builder) CompareInventory(ctx context.Context) (*InventoryComparison, error) {
+	if ab.inventoryTarget == nil {
+		return nil, errors.New("cannot compare inventory: no inventory target configured")
+	}
+	reader, ok := ab.applier.(inventoryReader)
+	if !ok {
+		return nil, errUnsupportedApplier(ab.applier, "ReadInventory")
+	}
+
+	docs, err := ab.documents()
+	if err != nil {
+		return nil, err
+	}
+
+	current := make([]InventoryEntry, 0, len(docs))
+	err = processDocuments(ctx, docs, func(ctx context.Context, doc sourceDocument) error {
+		ok, err := ab.isFiltered(doc.Filename, doc.doc)
+		if err != nil || !ok {
+			return err
+		}
+
+		entry, err := reader.ResolveInventoryEntry(ctx, doc.doc, ab.namespace, ApplyOptions{NamespacePolicy: ab.namespacePolicy})
 		if err != nil {
-			return fmt.Errorf("filtering resource failed for file %s: %w", filename, err)
+			return fmt.Errorf("could not resolve resource of file %s: %w", doc.Filename, err)
 		}
 
-		if !ok {
-			// is not filtered -> do not apply
-			return nil
+		current = append(current, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	inventory, err := reader.ReadInventory(ctx, *ab.inventoryTarget)
+	if err != nil {
+		return nil, fmt.Errorf("could not read inventory from %s: %w", *ab.inventoryTarget, err)
+	}
+
+	return inventory.Compare(current), nil
+}
+
+func (ab *Builder) applySetID() string {
+	return ApplySetID(ab.applySetName, ab.namespace, applySetParentKind.Kind, applySetParentKind.Group)
+}
+
+// applySetParent contains what is recorded on the parent resource of an apply set.
+type applySetParent struct {
+	groupKinds []schema.GroupKind
+	// namespaces contains the member namespaces which were recorded before the current run.
+	namespaces []string
+}
+
+// applyApplySetParent creates or updates the parent resource of the apply set before any member is applied so that
+// the parent already lists the kinds of all members. The recorded namespaces are extended by the namespaces of the
+// current members, so that members in namespaces which are removed from the manifests can still be pruned even if
+// this run is interrupted.
+func (ab *Builder) applyApplySetParent(ctx context.Context, docs []sourceDocument) (*applySetParent, error) {
+	if ab.namespace == "" {
+		return nil, fmt.Errorf("cannot use apply set %s: namespace must not be empty", ab.applySetName)
+	}
+
+	setPruner, ok := ab.applier.(pruner)
+	if !ok {
+		return nil, errUnsupportedApplier(ab.applier, "Prune")
+	}
+
+	recorded, err := setPruner.ApplySetNamespaces(ctx, ab.applySetName, ab.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("could not read parent of apply set %s: %w", ab.applySetName, err)
+	}
+
+	parent := &applySetParent{groupKinds: make([]schema.GroupKind, 0, len(docs)+len(ab.pruneAllowList)), namespaces: recorded}
+	namespaces := sets.New(recorded...)
+	for _, doc := range docs {
+		header, err := parseDocumentHeader(doc.doc)
+		if err != nil {
+			return nil, fmt.Errorf("could not determine kind of document in file %s: %w", doc.Filename, err)
 		}
+		parent.groupKinds = append(parent.groupKinds, header.groupKind())
+		namespaces.Insert(ab.documentNamespace(header))
+	}
+	for _, gvk := range ab.pruneAllowList {
+		parent.groupKinds = append(parent.groupKinds, gvk.GroupKind())
 	}
 
-	// Use ApplyWithOwner here even if no owner is set because it accepts nil owners
-	err = ab.applier.ApplyWithOwner(yamlDoc, ab.namespace, ab.owningResource)
+	err = ab.writeApplySetParent(ctx, parent.groupKinds, sets.List(namespaces))
 	if err != nil {
-		return fmt.Errorf("resource application failed for file %s: %w", filename, err)
+		return nil, err
+	}
+
+	return parent, nil
+}
+
+func (ab *Builder) writeApplySetParent(ctx context.Context, groupKinds []schema.GroupKind, namespaces []string) error {
+	parentDoc, err := applySetParentDocument(ab.applySetName, ab.namespace, groupKinds, namespaces)
+	if err != nil {
+		return err
+	}
+
+	_, err = ab.applyWithOptions(ctx, parentDoc, ab.namespace, ApplyOptions{DryRun: ab.dryRun})
+	if err != nil {
+		return fmt.Errorf("could not apply parent of apply set %s: %w", ab.applySetName, err)
 	}
 
 	return nil
 }
 
-func (ab *Builder) renderTemplates() error {
-	if len(ab.fileToTemplate) == 0 {
-		return nil
+// documentNamespace returns the namespace the document is applied to according to the namespace policy. The scope
+// of the kind is not considered because a superfluous namespace only widens the search for members to prune.
+func (ab *Builder) documentNamespace(header *documentHeader) string {
+	resource := &unstructured.Unstructured{}
+	resource.SetKind(header.Kind)
+	resource.SetName(header.Metadata.Name)
+	resource.SetNamespace(header.Metadata.Namespace)
+
+	namespace, err := resolveNamespace(resource, ab.namespace, ab.effectiveNamespacePolicy())
+	if err != nil {
+		// the document fails to apply anyway
+		return ab.namespace
 	}
 
-	for filename, resource := range ab.fileToGenericResource {
-		templateObject := ab.fileToTemplate[filename]
+	return namespace
+}
+
+// effectiveNamespacePolicy returns the namespace policy of the Builder or, if none is set, the namespace policy of the
+// Applier, just like the Applier resolves it when applying the documents.
+func (ab *Builder) effectiveNamespacePolicy() NamespacePolicy {
+	if applier, ok := ab.applier.(*Applier); ok {
+		return applier.effectiveNamespacePolicy(ab.namespacePolicy)
+	}
+
+	return ab.namespacePolicy
+}
+
+// errorNamespace returns the namespace which is reported for a failed document that could not be resolved by the
+// applier. Built-in cluster-scoped kinds have no namespace.
+func (ab *Builder) errorNamespace(header *documentHeader) string {
+	if clusterScopedKinds[header.groupKind()] {
+		return ""
+	}
+
+	return ab.documentNamespace(header)
+}
+
+// prune deletes the members of the apply set which were neither applied nor skipped in this run. Namespaced members
+// are searched in the recorded namespaces and in the namespaces of this run. Afterwards, the parent only records the
+// namespaces of the remaining members.
+func (ab *Builder) prune(ctx context.Context, parent *applySetParent, applied []DocumentResult, skipped []*documentHeader) ([]*unstructured.Unstructured, error) {
+	current := sets.New[string](ab.namespace)
+	for _, doc := range applied {
+		if doc.Object != nil && doc.Object.GetNamespace() != "" {
+			current.Insert(doc.Object.GetNamespace())
+		}
+	}
+	for _, header := range skipped {
+		current.Insert(ab.documentNamespace(header))
+	}
+
+	setPruner, ok := ab.applier.(pruner)
+	if !ok {
+		return nil, errUnsupportedApplier(ab.applier, "Prune")
+	}
+
+	pruned, err := setPruner.Prune(ctx, ab.applySetID(), PruneOptions{
+		AllowList:  ab.pruneAllowList,
+		Namespaces: sets.List(current.Clone().Insert(parent.namespaces...)),
+		Keep:       applySetKeepFunc(applied, skipped),
+		DryRun:     ab.dryRun,
+	})
+	if err != nil {
+		return pruned, fmt.Errorf("pruning apply set %s failed: %w", ab.applySetName, err)
+	}
+
+	err = ab.writeApplySetParent(ctx, parent.groupKinds, sets.List(current))
+	if err != nil {
+		return pruned, err
+	}
+
+	return pruned, nil
+}
 
-		transformedResource, err := renderTemplate(filename, resource, templateObject)
+// ExecuteDiff renders and splits the cumulated resources like ExecuteApply and compares each resource with its live
+// counterpart in the cluster. Nothing is persisted: the desired state is computed with a server-side dry-run apply.
+// Collectors are not run.
+func (ab *Builder) ExecuteDiff() ([]ResourceDiff, error) {
+	return ab.ExecuteDiffContext(context.Background())
+}
+
+// ExecuteDiffContext works like ExecuteDiff but aborts once the given context is cancelled or exceeds its deadline.
+func (ab *Builder) ExecuteDiffContext(ctx context.Context) ([]ResourceDiff, error) {
+	diffs := make([]ResourceDiff, 0)
+
+	resourceDiffer, ok := ab.applier.(differ)
+	if !ok {
+		return diffs, errUnsupportedApplier(ab.applier, "Diff")
+	}
+
+	docs, err := ab.documents()
+	if err != nil {
+		return diffs, err
+	}
+
+	// the desired state must match what ExecuteApply would send, including apply set labels
+	opts := ab.applyOptions()
+	opts.DryRun = true
+
+	err = processDocuments(ctx, docs, func(ctx context.Context, doc sourceDocument) error {
+		ok, err := ab.isFiltered(doc.Filename, doc.doc)
+		if err != nil || !ok {
+			return err
+		}
+
+		diff, err := resourceDiffer.Diff(ctx, doc.doc, ab.namespace, opts)
 		if err != nil {
+			return fmt.Errorf("resource diff failed for file %s: %w", doc.Filename, err)
+		}
+
+		diff.DocumentReference = doc.DocumentReference
+		diffs = append(diffs, *diff)
+		return nil
+	})
+
+	return diffs, err
+}
+
+// ExecuteDelete renders and splits the cumulated resources like ExecuteApply and deletes them from the cluster.
+// Resources are deleted in reverse dependency order, f. i. workloads before their service accounts and namespaces.
+// Resources which do not exist are considered as deleted. Only resources which match the ApplyFilter are deleted.
+// Collectors are not run.
+func (ab *Builder) ExecuteDelete() error {
+	return ab.ExecuteDeleteContext(context.Background())
+}
+
+// ExecuteDeleteContext works like ExecuteDelete but aborts once the given context is cancelled or exceeds its deadline.
+func (ab *Builder) ExecuteDeleteContext(ctx context.Context) error {
+	resourceDeleter, ok := ab.applier.(deleter)
+	if !ok {
+		return errUnsupportedApplier(ab.applier, "DeleteContext")
+	}
+
+	docs, err := ab.documents()
+	if err != nil {
+		return err
+	}
+
+	docs, err = sortDocumentsByKind(docs, true)
+	if err != nil {
+		return err
+	}
+
+	opts := DeleteOptions{PropagationPolicy: ab.deletePropagation, DryRun: ab.dryRun, NamespacePolicy: ab.namespacePolicy}
+	return processDocuments(ctx, docs, func(ctx context.Context, doc sourceDocument) error {
+		ok, err := ab.isFiltered(doc.Filename, doc.doc)
+		if err != nil || !ok {
 			return err
 		}
 
-		ab.fileToGenericResource[filename] = transformedResource
+		err = resourceDeleter.DeleteContext(ctx, doc.doc, ab.namespace, opts)
+		if err != nil {
+			return fmt.Errorf("resource deletion failed for file %s: %w", doc.Filename, err)
+		}
+
+		return nil
+	})
+}
+
+// processDocuments calls process for each document in order. It stops at the first error or once the context is done.
+// In the latter case all documents which were not processed are reported by an *UnappliedDocumentsError.
+func processDocuments(ctx context.Context, docs []sourceDocument, process func(ctx context.Context, doc sourceDocument) error) error {
+	for i, doc := range docs {
+		if ctx.Err() != nil {
+			return newUnappliedDocumentsError(ctx.Err(), docs[i:])
+		}
+
+		err := process(ctx, doc)
+		if err != nil {
+			if isContextError(err) {
+				return newUnappliedDocumentsError(err, docs[i:])
+			}
+			return err
+		}
 	}
 
 	return nil
 }
 
-func renderTemplate(filename string, templateText []byte, templateObject interface{}) ([]byte, error) {
-	const templateName = "t"
-	tpl := template.New(templateName)
+// processApplyDocuments processes the documents sequentially or, if configured by WithConcurrency, tier by tier with
+// multiple workers.
+func (ab *Builder) processApplyDocuments(ctx context.Context, docs []sourceDocument, process func(ctx context.Context, doc sourceDocument) error) error {
+	if ab.concurrency < 2 {
+		return processDocuments(ctx, docs, process)
+	}
 
-	parsed, err := tpl.Parse(string(templateText))
+	tiers, err := splitIntoTiers(docs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse template for file %s: %w", filename, err)
+		return err
+	}
+
+	return processDocumentsConcurrently(ctx, tiers, ab.concurrency, process)
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// applyDoc applies the document unless it is skipped by the ApplyFilter. The returned bool is false for skipped
+// documents.
+func (ab *Builder) applyDoc(ctx context.Context, filename string, yamlDoc YamlDocument) (*ResourceResult, bool, error) {
+	ok, err := ab.runCallbacks(filename, yamlDoc)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	applied, err := ab.applyWithOptions(ctx, yamlDoc, ab.namespace, ab.applyOptions())
+	if err != nil {
+		// the result may still identify the resource which failed
+		return applied, false, fmt.Errorf("resource application failed for file %s: %w", filename, err)
+	}
+
+	return applied, true, nil
+}
+
+// runCallbacks runs the collectors and the ApplyFilter for the given document. The callbacks are serialized so that
+// implementations need not be safe for concurrent use.
+func (ab *Builder) runCallbacks(filename string, yamlDoc YamlDocument) (bool, error) {
+	ab.callbackMutex.Lock()
+	defer ab.callbackMutex.Unlock()
+
+	err := ab.runCollectors(yamlDoc)
+	if err != nil {
+		return false, fmt.Errorf("resource collection failed for file %s: %w", filename, err)
+	}
+
+	return ab.isFiltered(filename, yamlDoc)
+}
+
+// applyWithOptions applies the document with the applier's ApplyWithOptions. Appliers which only implement
+// ApplyWithOwner are supported as long as no option besides the owner is set; their result does not contain the
+// applied resource.
+func (ab *Builder) applyWithOptions(ctx context.Context, doc YamlDocument, namespace string, opts ApplyOptions) (*ResourceResult, error) {
+	if optsApplier, ok := ab.applier.(optionsApplier); ok {
+		return optsApplier.ApplyWithOptions(ctx, doc, namespace, opts)
+	}
+
+	if opts.DryRun || len(opts.OwnerReferences) > 0 || len(opts.Labels) > 0 || (opts.NamespacePolicy != "" && opts.NamespacePolicy != NamespacePolicyEnforce) {
+		return nil, errUnsupportedApplier(ab.applier, "ApplyWithOptions")
+	}
+
+	err := ab.applier.ApplyWithOwner(doc, namespace, opts.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResourceResult{}, nil
+}
+
+func (ab *Builder) applyOptions() ApplyOptions {
+	// Owner may be nil because the applier accepts nil owners
+	opts := ApplyOptions{Owner: ab.owningResource, OwnerReferences: ab.ownerReferences, DryRun: ab.dryRun, NamespacePolicy: ab.namespacePolicy}
+	if ab.applySetName != "" {
+		opts.Labels = map[string]string{ApplySetPartOfLabel: ab.applySetID()}
+	}
+
+	return opts
+}
+
+// isFiltered returns true if the document passes the configured ApplyFilter and should be sent to the Kubernetes API.
+func (ab *Builder) isFiltered(filename string, yamlDoc YamlDocument) (bool, error) {
+	if ab.applyFilter == nil {
+		return true, nil
+	}
+
+	ok, err := ab.applyFilter.Predicate(yamlDoc)
+	if err != nil {
+		return false, fmt.Errorf("filtering resource failed for file %s: %w", filename, err)
+	}
+
+	return ok, nil
+}
+
+// documents renders all pending templates and splits the resulting resources into single YAML documents. The added
+// resources stay untouched so that a Builder can be executed more than once.
+func (ab *Builder) documents() ([]sourceDocument, error) {
+	if len(ab.loadErrors) > 0 {
+		return nil, fmt.Errorf("could not load manifests: %w", errors.Join(ab.loadErrors...))
 	}
 
-	resultWriter := bytes.NewBuffer([]byte{})
+	renderedResources, err := ab.renderTemplates()
+	if err != nil {
+		return nil, err
+	}
 
-	err = parsed.ExecuteTemplate(resultWriter, templateName, templateObject)
+	fileOrder, renderedResources, err := ab.renderHelmReleases(renderedResources)
 	if err != nil {
-		return nil, fmt.Errorf("failed to render template for file %s: %w", filename, err)
+		return nil, err
 	}
 
-	return resultWriter.Bytes(), nil
+	return expandDocuments(splitYamlDocs(fileOrder, renderedResources))
 }
 
-func (ab *Builder) splitYamlDocs() map[string][]YamlDocument {
-	allSingleYamlDocs := make(map[string][]YamlDocument)
+func (ab *Builder) renderTemplates() (map[string][]byte, error) {
+	if len(ab.fileToTemplate) == 0 {
+		return ab.fileToGenericResource, nil
+	}
+
+	renderedResources := make(map[string][]byte, len(ab.fileToGenericResource))
 	for filename, resource := range ab.fileToGenericResource {
-		yamlDocs := splitResourceIntoDocuments(resource)
-		allSingleYamlDocs[filename] = yamlDocs
+		if ab.renderedFiles[filename] {
+			renderedResources[filename] = resource
+			continue
+		}
+
+		templateObject := ab.fileToTemplate[filename]
+
+		renderer, ok := ab.fileToRenderer[filename]
+		if !ok {
+			renderer = &ab.goTemplateRenderer
+		}
+
+		transformedResource, err := renderer.Render(filename, resource, templateObject)
+		if err != nil {
+			return nil, err
+		}
+
+		renderedResources[filename] = transformedResource
+	}
+
+	return renderedResources, nil
+}
+
+// sourceDocument is a single YAML document together with its origin.
+type sourceDocument struct {
+	DocumentReference
+	doc YamlDocument
+}
+
+func splitYamlDocs(fileOrder []string, fileToResource map[string][]byte) []sourceDocument {
+	allSingleYamlDocs := make([]sourceDocument, 0)
+	for _, filename := range fileOrder {
+		yamlDocs := splitResourceIntoDocuments(fileToResource[filename])
+		for i, yamlDoc := range yamlDocs {
+			allSingleYamlDocs = append(allSingleYamlDocs, sourceDocument{
+				DocumentReference: DocumentReference{Filename: filename, Index: i},
+				doc:               yamlDoc,
+			})
+		}
 	}
 
 	return allSingleYamlDocs
@@ -242,17 +988,71 @@ func (ab *Builder) runCollectors(doc YamlDocument) error {
 	return nil
 }
 
+// splitResourceIntoDocuments reads the YAML stream line by line and returns its documents. Documents are separated by
+// "---" lines, which may carry trailing comments, and may be terminated by "..." lines. Both LF and CRLF line endings
+// are supported. Documents which only contain comments or whitespace are skipped.
 func splitResourceIntoDocuments(resourceBytes []byte) []YamlDocument {
-	yamlFileSeparator := []byte("---\n")
+	documents := make([]YamlDocument, 0)
+	current := make([]byte, 0)
+	flush := func() {
+		if hasYamlContent(current) {
+			documents = append(documents, current)
+		}
+		current = make([]byte, 0)
+	}
+
+	for _, line := range bytes.SplitAfter(resourceBytes, []byte("\n")) {
+		trimmed := bytes.TrimRight(line, "\r\n")
+		switch {
+		case isDocumentSeparator(trimmed):
+			flush()
+			// content may follow the separator on the same line, f. i. "--- !tag" or "--- key: value"
+			rest := bytes.TrimSpace(trimmed[len(yamlDocumentSeparator):])
+			if len(rest) > 0 && rest[0] != '#' {
+				current = append(current, rest...)
+				current = append(current, '\n')
+			}
+		case isDocumentEnd(trimmed):
+			flush()
+		default:
+			current = append(current, line...)
+		}
+	}
+	flush()
+
+	return documents
+}
+
+const (
+	yamlDocumentSeparator = "---"
+	yamlDocumentEnd       = "..."
+)
+
+func isDocumentSeparator(line []byte) bool {
+	return isMarkerLine(line, yamlDocumentSeparator)
+}
 
-	preResult := bytes.Split(resourceBytes, yamlFileSeparator)
+func isDocumentEnd(line []byte) bool {
+	return isMarkerLine(line, yamlDocumentEnd)
+}
+
+// isMarkerLine returns true if the line starts with the marker which is followed by whitespace or nothing.
+func isMarkerLine(line []byte, marker string) bool {
+	if !bytes.HasPrefix(line, []byte(marker)) {
+		return false
+	}
+
+	return len(line) == len(marker) || line[len(marker)] == ' ' || line[len(marker)] == '\t'
+}
 
-	cleanedResult := make([]YamlDocument, 0)
-	for _, section := range preResult {
-		if len(section) > 0 {
-			cleanedResult = append(cleanedResult, section)
+// hasYamlContent returns false for documents which only consist of comments and whitespace.
+func hasYamlContent(doc []byte) bool {
+	for _, line := range bytes.Split(doc, []byte("\n")) {
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) > 0 && trimmed[0] != '#' {
+			return true
 		}
 	}
 
-	return cleanedResult
+	return false
 }
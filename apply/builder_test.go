@@ -1,16 +1,20 @@
 package apply
 
 import (
+	"context"
 	_ "embed"
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/yaml"
 )
 
@@ -70,6 +74,18 @@ func TestBuilder_WithYamlResource(t *testing.T) {
 		assert.NotEmpty(t, sut.fileToGenericResource[testFile2])
 		assert.Equal(t, multiDocYamlTemplateBytes, sut.fileToGenericResource[testFile2])
 	})
+	t.Run("should keep the order in which files were added", func(t *testing.T) {
+		sut := NewBuilder(nil)
+
+		// when
+		sut.WithYamlResource(testFile2, multiDocYamlBytes).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			WithYamlResource(testFile2, singleDocYamlBytes)
+
+		// then
+		assert.Equal(t, []string{testFile2, testFile1}, sut.fileOrder)
+		assert.Equal(t, singleDocYamlBytes, sut.fileToGenericResource[testFile2])
+	})
 }
 
 func TestBuilder_WithTemplate(t *testing.T) {
@@ -169,6 +185,58 @@ func TestBuilder_WithApplyFilter(t *testing.T) {
 	})
 }
 
+func TestBuilder_WithDryRun(t *testing.T) {
+	t.Run("should enable dry-run", func(t *testing.T) {
+		sut := NewBuilder(nil)
+
+		// when
+		sut.WithDryRun()
+
+		// then
+		assert.True(t, sut.dryRun)
+	})
+}
+
+func TestBuilder_WithPrune(t *testing.T) {
+	t.Run("should enable pruning for the given kinds", func(t *testing.T) {
+		sut := NewBuilder(nil)
+		deployments := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+
+		// when
+		sut.WithPrune(testApplySetName, deployments)
+
+		// then
+		assert.Equal(t, testApplySetName, sut.applySetName)
+		assert.Equal(t, []schema.GroupVersionKind{deployments}, sut.pruneAllowList)
+	})
+}
+
+func TestBuilder_WithInventory(t *testing.T) {
+	t.Run("should set the inventory target", func(t *testing.T) {
+		sut := NewBuilder(nil)
+		target := ConfigMapInventory(testNamespace, testInventoryName)
+
+		// when
+		sut.WithInventory(target)
+
+		// then
+		require.NotNil(t, sut.inventoryTarget)
+		assert.Equal(t, target, *sut.inventoryTarget)
+	})
+}
+
+func TestBuilder_WithDeletePropagation(t *testing.T) {
+	t.Run("should set the propagation policy", func(t *testing.T) {
+		sut := NewBuilder(nil)
+
+		// when
+		sut.WithDeletePropagation(metav1.DeletePropagationForeground)
+
+		// then
+		assert.Equal(t, metav1.DeletePropagationForeground, sut.deletePropagation)
+	})
+}
+
 func Test_renderTemplate(t *testing.T) {
 	t.Run("should template namespace", func(t *testing.T) {
 		tempDoc := []byte(`hello {{ .Namespace }}`)
@@ -178,7 +246,7 @@ func Test_renderTemplate(t *testing.T) {
 			Namespace: testNamespace,
 		}
 
-		actual, err := renderTemplate(testFile1, tempDoc, templateObj1)
+		actual, err := (&GoTemplateRenderer{}).Render(testFile1, tempDoc, templateObj1)
 
 		require.NoError(t, err)
 		expected := []byte(`hello le-namespace`)
@@ -193,7 +261,7 @@ func Test_renderTemplate(t *testing.T) {
 			Namespace: testNamespace,
 		}
 
-		_, err := renderTemplate(testFile1, tempDoc, templateObj1)
+		_, err := (&GoTemplateRenderer{}).Render(testFile1, tempDoc, templateObj1)
 
 		require.Error(t, err)
 		assert.Equal(t, "failed to parse template for file /dir/file1.yaml: template: t:1: unclosed action", err.Error())
@@ -203,19 +271,48 @@ func Test_renderTemplate(t *testing.T) {
 		tempDoc := []byte(`hello {{ .Namespace }}`)
 		templateObj1 := struct{}{}
 
-		_, err := renderTemplate(testFile1, tempDoc, templateObj1)
+		_, err := (&GoTemplateRenderer{}).Render(testFile1, tempDoc, templateObj1)
 
 		require.Error(t, err)
 		assert.ErrorContains(t, err, "failed to render template for file /dir/file1.yaml")
 	})
 }
 
+func Test_splitResourceIntoDocuments(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+		want     []string
+	}{
+		{"LF separators", "a: 1\n---\nb: 2\n", []string{"a: 1\n", "b: 2\n"}},
+		{"CRLF separators", "a: 1\r\n---\r\nb: 2\r\n", []string{"a: 1\r\n", "b: 2\r\n"}},
+		{"separator with comment", "a: 1\n--- # second\nb: 2\n", []string{"a: 1\n", "b: 2\n"}},
+		{"separator with content", "--- a: 1\n", []string{"a: 1\n"}},
+		{"separator at end of file", "a: 1\n---", []string{"a: 1\n"}},
+		{"document end marker", "a: 1\n...\n---\nb: 2\n...\n", []string{"a: 1\n", "b: 2\n"}},
+		{"block scalar containing a separator", "a: |\n  ---\n  text\n---\nb: 2\n", []string{"a: |\n  ---\n  text\n", "b: 2\n"}},
+		{"value starting with dashes", "a: 1\n----\n", []string{"a: 1\n----\n"}},
+		{"comment-only and empty documents", "# header\n---\n\n  \n---\n# only comments\n---\na: 1\n", []string{"a: 1\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := splitResourceIntoDocuments([]byte(tt.resource))
+
+			expected := make([]YamlDocument, 0, len(tt.want))
+			for _, doc := range tt.want {
+				expected = append(expected, YamlDocument(doc))
+			}
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
 func TestBuilder_ExecuteApply(t *testing.T) {
 	t.Run("should apply a simple file resource", func(t *testing.T) {
 		// given
 		doc1 := YamlDocument(singleDocYamlBytes)
 		mockedApplier := &mockApplier{}
-		mockedApplier.On("ApplyWithOwner", doc1, testNamespace, nil).Return(nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, doc1, testNamespace, ApplyOptions{}).Return(&ResourceResult{}, nil)
 
 		sut := NewBuilder(mockedApplier)
 
@@ -242,7 +339,7 @@ func TestBuilder_ExecuteApply(t *testing.T) {
 		}
 		doc1 := YamlDocument(singleDocYamlBytes)
 		mockedApplier := &mockApplier{}
-		mockedApplier.On("ApplyWithOwner", doc1, testNamespace, owner).Return(nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, doc1, testNamespace, ApplyOptions{Owner: owner}).Return(&ResourceResult{}, nil)
 
 		sut := NewBuilder(mockedApplier)
 
@@ -271,8 +368,8 @@ metadata:
   name: another-service-account
 `)
 		mockedApplier := &mockApplier{}
-		mockedApplier.On("ApplyWithOwner", expectedNamespaceDoc, testNamespace, nil).Return(nil)
-		mockedApplier.On("ApplyWithOwner", expectedServiceAccountDoc, testNamespace, nil).Return(nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, expectedNamespaceDoc, testNamespace, ApplyOptions{}).Return(&ResourceResult{}, nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, expectedServiceAccountDoc, testNamespace, ApplyOptions{}).Return(&ResourceResult{}, nil)
 
 		sut := NewBuilder(mockedApplier)
 		doc := YamlDocument(multiDocYamlTemplateBytes)
@@ -300,7 +397,7 @@ metadata:
   name: another-service-account
 `)
 		mockedApplier := &mockApplier{}
-		mockedApplier.On("ApplyWithOwner", expectedServiceAccountDoc, testNamespace, nil).Return(nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, expectedServiceAccountDoc, testNamespace, ApplyOptions{}).Return(&ResourceResult{}, nil)
 
 		sut := NewBuilder(mockedApplier)
 		doc := YamlDocument(multiDocYamlTemplateBytes)
@@ -336,8 +433,8 @@ metadata:
   name: another-service-account
 `)
 		mockedApplier := &mockApplier{}
-		mockedApplier.On("ApplyWithOwner", expectedNamespaceDoc, testNamespace, nil).Return(nil)
-		mockedApplier.On("ApplyWithOwner", expectedServiceAccountDoc, testNamespace, nil).Return(nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, expectedNamespaceDoc, testNamespace, ApplyOptions{}).Return(&ResourceResult{}, nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, expectedServiceAccountDoc, testNamespace, ApplyOptions{}).Return(&ResourceResult{}, nil)
 
 		sut := NewBuilder(mockedApplier)
 
@@ -371,7 +468,7 @@ metadata:
 		// given
 		doc1 := YamlDocument("Invalid template {{.foo}")
 		mockedApplier := &mockApplier{}
-		mockedApplier.On("ApplyWithOwner", doc1, testNamespace, nil).Return(nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, doc1, testNamespace, ApplyOptions{}).Return(&ResourceResult{}, nil)
 
 		sut := NewBuilder(mockedApplier).WithYamlResource(testFile1, doc1).WithTemplate(testFile1, doc1)
 
@@ -398,7 +495,7 @@ metadata:
 		}
 		doc1 := YamlDocument(singleDocYamlBytes)
 		mockedApplier := &mockApplier{}
-		mockedApplier.On("ApplyWithOwner", doc1, testNamespace, owner).Return(nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, doc1, testNamespace, ApplyOptions{Owner: owner}).Return(&ResourceResult{}, nil)
 
 		sut := NewBuilder(mockedApplier)
 
@@ -428,7 +525,7 @@ metadata:
 		}
 		doc1 := YamlDocument(singleDocYamlBytes)
 		mockedApplier := &mockApplier{}
-		mockedApplier.On("ApplyWithOwner", doc1, testNamespace, owner).Return(nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, doc1, testNamespace, ApplyOptions{Owner: owner}).Return(&ResourceResult{}, nil)
 
 		sut := NewBuilder(mockedApplier)
 
@@ -458,7 +555,7 @@ metadata:
 		}
 		doc1 := YamlDocument(singleDocYamlBytes)
 		mockedApplier := &mockApplier{}
-		mockedApplier.On("ApplyWithOwner", doc1, testNamespace, owner).Return(assert.AnError)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, doc1, testNamespace, ApplyOptions{Owner: owner}).Return(nil, assert.AnError)
 
 		sut := NewBuilder(mockedApplier)
 
@@ -475,6 +572,740 @@ metadata:
 	})
 }
 
+func TestBuilder_ExecuteApply_order(t *testing.T) {
+	t.Run("should apply documents by kind and keep the file order within a kind", func(t *testing.T) {
+		// given
+		deploymentDoc := YamlDocument("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: le-deployment\n")
+		firstServiceAccountDoc := YamlDocument("apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: first\n")
+		secondServiceAccountDoc := YamlDocument("apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: second\n")
+		namespaceDoc := YamlDocument("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: le-namespace\n")
+
+		mockedApplier := &mockApplier{}
+		namespaceCall := mockedApplier.On("ApplyWithOptions", mock.Anything, namespaceDoc, testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{}, nil).Once()
+		firstServiceAccountCall := mockedApplier.On("ApplyWithOptions", mock.Anything, firstServiceAccountDoc, testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{}, nil).Once().NotBefore(namespaceCall)
+		secondServiceAccountCall := mockedApplier.On("ApplyWithOptions", mock.Anything, secondServiceAccountDoc, testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{}, nil).Once().NotBefore(firstServiceAccountCall)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, deploymentDoc, testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{}, nil).Once().NotBefore(secondServiceAccountCall)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		actual, err := sut.WithNamespace(testNamespace).
+			WithYamlResource("/dir/deployment.yaml", append(append(deploymentDoc, "---\n"...), firstServiceAccountDoc...)).
+			WithYamlResource("/dir/second.yaml", secondServiceAccountDoc).
+			WithYamlResource("/dir/namespace.yaml", namespaceDoc).
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.NoError(t, err)
+		expectedOrder := []DocumentReference{
+			{Filename: "/dir/namespace.yaml", Index: 0},
+			{Filename: "/dir/deployment.yaml", Index: 1},
+			{Filename: "/dir/second.yaml", Index: 0},
+			{Filename: "/dir/deployment.yaml", Index: 0},
+		}
+		actualOrder := make([]DocumentReference, 0, len(actual.Documents))
+		for _, doc := range actual.Documents {
+			actualOrder = append(actualOrder, doc.DocumentReference)
+		}
+		assert.Equal(t, expectedOrder, actualOrder)
+		mockedApplier.AssertExpectations(t)
+	})
+}
+
+func TestBuilder_ExecuteApplyContext(t *testing.T) {
+	t.Run("should not apply anything for an already cancelled context", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		sut := NewBuilder(mockedApplier)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// when
+		err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			ExecuteApplyContext(ctx)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.Canceled)
+		var unappliedErr *UnappliedDocumentsError
+		require.ErrorAs(t, err, &unappliedErr)
+		assert.Equal(t, []DocumentReference{{Filename: testFile1, Index: 0}, {Filename: testFile1, Index: 1}}, unappliedErr.Unapplied())
+		mockedApplier.AssertNotCalled(t, "ApplyWithOptions", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("should pass the context to the applier", func(t *testing.T) {
+		// given
+		type ctxKey struct{}
+		ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+		doc1 := YamlDocument(singleDocYamlBytes)
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", ctx, doc1, testNamespace, ApplyOptions{}).Return(&ResourceResult{}, nil)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, doc1).
+			ExecuteApplyContext(ctx)
+
+		// then
+		require.NoError(t, err)
+		mockedApplier.AssertExpectations(t)
+	})
+	t.Run("should report documents as unapplied when the applier runs into the deadline", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, ApplyOptions{}).
+			Return(nil, fmt.Errorf("error while patching: %w", context.DeadlineExceeded)).Once()
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			ExecuteApplyContext(context.Background())
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		var unappliedErr *UnappliedDocumentsError
+		require.ErrorAs(t, err, &unappliedErr)
+		assert.Len(t, unappliedErr.Unapplied(), 2)
+		mockedApplier.AssertExpectations(t)
+	})
+}
+
+func TestBuilder_ExecuteApplyWithResult(t *testing.T) {
+	t.Run("should return the server-computed resources of a dry-run", func(t *testing.T) {
+		// given
+		serverNamespace := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Namespace"}}
+		serverServiceAccount := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ServiceAccount"}}
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, ApplyOptions{DryRun: true}).
+			Return(&ResourceResult{Object: serverNamespace}, nil).Once()
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, ApplyOptions{DryRun: true}).
+			Return(&ResourceResult{Object: serverServiceAccount}, nil).Once()
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		actual, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			WithDryRun().
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.NoError(t, err)
+		expected := []DocumentResult{
+			{DocumentReference: DocumentReference{Filename: testFile1, Index: 0}, ResourceResult: ResourceResult{Object: serverNamespace}},
+			{DocumentReference: DocumentReference{Filename: testFile1, Index: 1}, ResourceResult: ResourceResult{Object: serverServiceAccount}},
+		}
+		assert.Equal(t, expected, actual.Documents)
+		mockedApplier.AssertExpectations(t)
+	})
+	t.Run("should not list filtered documents", func(t *testing.T) {
+		// given
+		serverServiceAccount := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ServiceAccount"}}
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{Object: serverServiceAccount}, nil)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		actual, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			WithApplyFilter(&predicatedServiceAccountCollector{}).
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, actual.Documents, 1)
+		assert.Equal(t, DocumentReference{Filename: testFile1, Index: 1}, actual.Documents[0].DocumentReference)
+		mockedApplier.AssertExpectations(t)
+	})
+}
+
+func TestBuilder_ExecuteApplyWithResult_prune(t *testing.T) {
+	serviceAccounts := schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"}
+	expectedParent := YamlDocument(`apiVersion: v1
+kind: Secret
+metadata:
+  annotations:
+    applyset.kubernetes.io/contains-group-kinds: Namespace,ServiceAccount
+    applyset.kubernetes.io/tooling: k8s-apply-lib/v1
+  labels:
+    applyset.kubernetes.io/id: ` + testApplySetID + `
+  name: le-apply-set
+  namespace: le-namespace
+`)
+	memberOptions := ApplyOptions{Labels: map[string]string{ApplySetPartOfLabel: testApplySetID}}
+	newParent := func(additionalNamespaces string) YamlDocument {
+		return YamlDocument(`apiVersion: v1
+kind: Secret
+metadata:
+  annotations:
+    applyset.kubernetes.io/additional-namespaces: ` + additionalNamespaces + `
+    applyset.kubernetes.io/contains-group-kinds: Namespace,ServiceAccount
+    applyset.kubernetes.io/tooling: k8s-apply-lib/v1
+  labels:
+    applyset.kubernetes.io/id: ` + testApplySetID + `
+  name: le-apply-set
+  namespace: le-namespace
+`)
+	}
+
+	t.Run("should label members and prune removed resources after applying", func(t *testing.T) {
+		// given
+		appliedServiceAccount := &unstructured.Unstructured{}
+		appliedServiceAccount.SetNamespace("other-namespace")
+		prunedServiceAccount := &unstructured.Unstructured{}
+
+		mockedApplier := &mockApplier{}
+		readCall := mockedApplier.On("ApplySetNamespaces", mock.Anything, testApplySetName, testNamespace).
+			Return([]string{testNamespace, "removed-namespace"}, nil).Once()
+		parentCall := mockedApplier.On("ApplyWithOptions", mock.Anything, newParent("removed-namespace"), testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{Object: &unstructured.Unstructured{}}, nil).Once().NotBefore(readCall)
+		applyCall := mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, memberOptions).
+			Return(&ResourceResult{Object: appliedServiceAccount}, nil).Twice().NotBefore(parentCall)
+		pruneCall := mockedApplier.On("Prune", mock.Anything, testApplySetID, mock.MatchedBy(func(opts PruneOptions) bool {
+			return assert.ObjectsAreEqual([]schema.GroupVersionKind{serviceAccounts}, opts.AllowList) &&
+				assert.ObjectsAreEqual([]string{testNamespace, "other-namespace", "removed-namespace"}, opts.Namespaces) &&
+				opts.Keep != nil && !opts.DryRun
+		})).Return([]*unstructured.Unstructured{prunedServiceAccount}, nil).NotBefore(applyCall)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, newParent("other-namespace"), testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{Object: &unstructured.Unstructured{}}, nil).Once().NotBefore(pruneCall)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		actual, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			WithPrune(testApplySetName, serviceAccounts).
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.NoError(t, err)
+		assert.Len(t, actual.Documents, 2)
+		assert.Equal(t, []*unstructured.Unstructured{prunedServiceAccount}, actual.Pruned)
+		mockedApplier.AssertExpectations(t)
+	})
+	t.Run("should not prune if applying fails", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplySetNamespaces", mock.Anything, testApplySetName, testNamespace).Return([]string{testNamespace}, nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, expectedParent, testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{Object: &unstructured.Unstructured{}}, nil).Once()
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, memberOptions).
+			Return(nil, assert.AnError).Once()
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		_, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			WithPrune(testApplySetName, serviceAccounts).
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		mockedApplier.AssertNotCalled(t, "Prune", mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("should fail without namespace", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		_, err := sut.WithYamlResource(testFile1, multiDocYamlBytes).
+			WithPrune(testApplySetName, serviceAccounts).
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "cannot use apply set le-apply-set: namespace must not be empty")
+	})
+	t.Run("should fail to read the recorded namespaces", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplySetNamespaces", mock.Anything, testApplySetName, testNamespace).Return(nil, assert.AnError)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		_, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			WithPrune(testApplySetName, serviceAccounts).
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "could not read parent of apply set le-apply-set")
+		mockedApplier.AssertNotCalled(t, "ApplyWithOptions", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("should fail to prune", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplySetNamespaces", mock.Anything, testApplySetName, testNamespace).Return([]string{testNamespace}, nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, mock.Anything).
+			Return(&ResourceResult{Object: &unstructured.Unstructured{}}, nil)
+		mockedApplier.On("Prune", mock.Anything, testApplySetID, mock.Anything).Return(nil, assert.AnError)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		_, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			WithPrune(testApplySetName, serviceAccounts).
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "pruning apply set le-apply-set failed")
+	})
+}
+
+func TestBuilder_ExecuteApplyWithResult_continueOnError(t *testing.T) {
+	namespaceDoc := YamlDocument("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: le-namespace\n")
+	serviceAccountDoc := YamlDocument("apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: le-service-account\n")
+	configMapDoc := YamlDocument("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: le-config-map\n")
+	content := append(append([]byte(string(namespaceDoc)+"---\n"), serviceAccountDoc...), []byte("---\n"+string(configMapDoc))...)
+
+	t.Run("should apply all documents and aggregate the errors", func(t *testing.T) {
+		// given
+		serverConfigMap := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap"}}
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", mock.Anything, namespaceDoc, testNamespace, ApplyOptions{}).Return(nil, assert.AnError)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, serviceAccountDoc, testNamespace, ApplyOptions{}).Return(nil, assert.AnError)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, configMapDoc, testNamespace, ApplyOptions{}).Return(&ResourceResult{Object: serverConfigMap}, nil)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		actual, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, content).
+			WithContinueOnError().
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.Error(t, err)
+		var applyErrs *ApplyErrors
+		require.ErrorAs(t, err, &applyErrs)
+		require.Len(t, applyErrs.Errors(), 2)
+		assert.Equal(t, DocumentReference{Filename: testFile1, Index: 0}, applyErrs.Errors()[0].Document())
+		assert.Equal(t, "le-namespace", applyErrs.Errors()[0].Name())
+		assert.Empty(t, applyErrs.Errors()[0].Namespace())
+		assert.Equal(t, DocumentReference{Filename: testFile1, Index: 1}, applyErrs.Errors()[1].Document())
+		assert.Equal(t, "ServiceAccount", applyErrs.Errors()[1].GroupVersionKind().Kind)
+		assert.ErrorIs(t, err, assert.AnError)
+		require.Len(t, actual.Documents, 1)
+		assert.Equal(t, serverConfigMap, actual.Documents[0].Object)
+		mockedApplier.AssertExpectations(t)
+	})
+	t.Run("should report the namespace the documents are applied to", func(t *testing.T) {
+		// given
+		resolvedDoc := YamlDocument("apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: resolved\n  namespace: declared\n")
+		unresolvedDoc := YamlDocument("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: unresolved\n  namespace: declared\n")
+		resolved := &ResourceResult{GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"}, Namespace: testNamespace, Name: "resolved"}
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", mock.Anything, resolvedDoc, testNamespace, ApplyOptions{}).Return(resolved, assert.AnError)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, unresolvedDoc, testNamespace, ApplyOptions{}).Return(nil, assert.AnError)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		_, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, []byte(string(resolvedDoc)+"---\n"+string(unresolvedDoc))).
+			WithContinueOnError().
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		var applyErrs *ApplyErrors
+		require.ErrorAs(t, err, &applyErrs)
+		require.Len(t, applyErrs.Errors(), 2)
+		assert.Equal(t, "resolved", applyErrs.Errors()[0].Name())
+		assert.Equal(t, testNamespace, applyErrs.Errors()[0].Namespace())
+		assert.Equal(t, "unresolved", applyErrs.Errors()[1].Name())
+		assert.Equal(t, testNamespace, applyErrs.Errors()[1].Namespace())
+	})
+	t.Run("should not prune if documents failed", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplySetNamespaces", mock.Anything, testApplySetName, testNamespace).Return([]string{testNamespace}, nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, ApplyOptions{}).Return(&ResourceResult{Object: &unstructured.Unstructured{}}, nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, mock.Anything).Return(nil, assert.AnError)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		_, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, content).
+			WithPrune(testApplySetName, schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}).
+			WithContinueOnError().
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		var applyErrs *ApplyErrors
+		require.ErrorAs(t, err, &applyErrs)
+		assert.Len(t, applyErrs.Errors(), 3)
+		mockedApplier.AssertNotCalled(t, "Prune", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestBuilder_ExecuteApplyWithResult_wait(t *testing.T) {
+	t.Run("should wait for the applied resources", func(t *testing.T) {
+		// given
+		serverNamespace := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "Namespace"}}
+		serverServiceAccount := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ServiceAccount"}}
+		expectedStatuses := []ResourceStatus{{Name: "le-namespace", Status: ReadinessStatusReady}}
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{Object: serverNamespace}, nil).Once()
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{Object: serverServiceAccount}, nil).Once()
+		mockedApplier.On("WaitForReady", mock.Anything, []*unstructured.Unstructured{serverNamespace, serverServiceAccount}, WaitOptions{Timeout: time.Minute}).
+			Return(expectedStatuses, nil)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		actual, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			WithWait(time.Minute).
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, expectedStatuses, actual.Statuses)
+		mockedApplier.AssertExpectations(t)
+	})
+	t.Run("should return the error of the wait", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{Object: &unstructured.Unstructured{}}, nil)
+		waitErr := &WaitError{err: assert.AnError}
+		mockedApplier.On("WaitForReady", mock.Anything, mock.Anything, mock.Anything).Return(nil, waitErr)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		_, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			WithWait(time.Minute).
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, waitErr)
+		assert.ErrorContains(t, err, "waiting for applied resources failed")
+	})
+	t.Run("should not wait during a dry-run", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, ApplyOptions{DryRun: true}).
+			Return(&ResourceResult{Object: &unstructured.Unstructured{}}, nil)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		_, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			WithWait(time.Minute).
+			WithDryRun().
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.NoError(t, err)
+		mockedApplier.AssertNotCalled(t, "WaitForReady", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestBuilder_ExecuteApplyWithResult_inventory(t *testing.T) {
+	t.Run("should write all applied resources to the inventory", func(t *testing.T) {
+		// given
+		appliedNamespace := &unstructured.Unstructured{}
+		appliedNamespace.SetAPIVersion("v1")
+		appliedNamespace.SetKind("Namespace")
+		appliedNamespace.SetName("le-namespace")
+		appliedNamespace.SetUID("2")
+		expectedInventoryDoc := YamlDocument(`apiVersion: v1
+data:
+  inventory: '{"entries":[{"group":"","version":"v1","kind":"Namespace","name":"le-namespace","uid":"2"}]}'
+kind: ConfigMap
+metadata:
+  name: le-inventory
+  namespace: le-namespace
+`)
+
+		mockedApplier := &mockApplier{}
+		applyCall := mockedApplier.On("ApplyWithOptions", mock.Anything, YamlDocument(singleDocYamlBytes), testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{Object: appliedNamespace}, nil).Once()
+		mockedApplier.On("ApplyWithOptions", mock.Anything, expectedInventoryDoc, testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{Object: &unstructured.Unstructured{}}, nil).Once().NotBefore(applyCall)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, singleDocYamlBytes).
+			WithInventory(ConfigMapInventory(testNamespace, testInventoryName)).
+			ExecuteApply()
+
+		// then
+		require.NoError(t, err)
+		mockedApplier.AssertExpectations(t)
+	})
+	t.Run("should fail to write the inventory", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", mock.Anything, YamlDocument(singleDocYamlBytes), testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{Object: &unstructured.Unstructured{}}, nil).Once()
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, ApplyOptions{}).
+			Return(nil, assert.AnError).Once()
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, singleDocYamlBytes).
+			WithInventory(ConfigMapInventory(testNamespace, testInventoryName)).
+			ExecuteApply()
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "could not write inventory to ConfigMap le-namespace/le-inventory")
+	})
+}
+
+func TestBuilder_CompareInventory(t *testing.T) {
+	t.Run("should compare the stored inventory with the current manifests", func(t *testing.T) {
+		// given
+		currentNamespace := testNamespaceEntry
+		currentNamespace.UID = ""
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ResolveInventoryEntry", mock.Anything, YamlDocument(singleDocYamlBytes), testNamespace, ApplyOptions{}).
+			Return(currentNamespace, nil)
+		mockedApplier.On("ReadInventory", mock.Anything, ConfigMapInventory(testNamespace, testInventoryName)).
+			Return(&Inventory{Entries: []InventoryEntry{testNamespaceEntry, testServiceAccountEntry}}, nil)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		actual, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, singleDocYamlBytes).
+			WithInventory(ConfigMapInventory(testNamespace, testInventoryName)).
+			CompareInventory(context.Background())
+
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, actual.Added)
+		assert.Equal(t, []InventoryEntry{testServiceAccountEntry}, actual.Removed)
+		assert.Equal(t, []InventoryEntry{testNamespaceEntry}, actual.Retained)
+		mockedApplier.AssertExpectations(t)
+	})
+	t.Run("should fail without inventory target", func(t *testing.T) {
+		// when
+		_, err := NewBuilder(&mockApplier{}).CompareInventory(context.Background())
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "no inventory target configured")
+	})
+	t.Run("should fail to read the inventory", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ReadInventory", mock.Anything, mock.Anything).Return(nil, assert.AnError)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		_, err := sut.WithNamespace(testNamespace).
+			WithInventory(ConfigMapInventory(testNamespace, testInventoryName)).
+			CompareInventory(context.Background())
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "could not read inventory from ConfigMap le-namespace/le-inventory")
+	})
+}
+
+func TestBuilder_ExecuteDiff(t *testing.T) {
+	t.Run("should diff each filtered document without collecting it", func(t *testing.T) {
+		// given
+		expectedServiceAccountDoc := YamlDocument(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: le-service-account
+`)
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("Diff", mock.Anything, expectedServiceAccountDoc, testNamespace, ApplyOptions{DryRun: true}).
+			Return(&ResourceDiff{Name: "le-service-account", Status: DiffStatusCreated}, nil)
+		collector := &predicatedServiceAccountCollector{}
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		actual, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			WithApplyFilter(&predicatedServiceAccountCollector{}).
+			WithCollector(collector).
+			ExecuteDiff()
+
+		// then
+		require.NoError(t, err)
+		expected := []ResourceDiff{{
+			DocumentReference: DocumentReference{Filename: testFile1, Index: 1},
+			Name:              "le-service-account",
+			Status:            DiffStatusCreated,
+		}}
+		assert.Equal(t, expected, actual)
+		assert.Empty(t, collector.collected)
+		mockedApplier.AssertExpectations(t)
+	})
+	t.Run("should fail to diff", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("Diff", mock.Anything, mock.Anything, testNamespace, ApplyOptions{DryRun: true}).Return(nil, assert.AnError)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		_, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, singleDocYamlBytes).
+			ExecuteDiff()
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "resource diff failed for file /dir/file1.yaml")
+	})
+	t.Run("should diff with the same labels as apply", func(t *testing.T) {
+		// given
+		expectedOptions := ApplyOptions{DryRun: true, Labels: map[string]string{ApplySetPartOfLabel: testApplySetID}}
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("Diff", mock.Anything, mock.Anything, testNamespace, expectedOptions).Return(&ResourceDiff{}, nil)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		_, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, singleDocYamlBytes).
+			WithPrune(testApplySetName).
+			ExecuteDiff()
+
+		// then
+		require.NoError(t, err)
+		mockedApplier.AssertExpectations(t)
+	})
+	t.Run("should render templates only once per run", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("Diff", mock.Anything, mock.Anything, testNamespace, ApplyOptions{DryRun: true}).
+			Return(&ResourceDiff{}, nil)
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{}, nil)
+		templateObj := struct {
+			Namespace string
+		}{
+			Namespace: testNamespace,
+		}
+
+		sut := NewBuilder(mockedApplier).
+			WithNamespace(testNamespace).
+			WithYamlResource(testFile2, multiDocYamlTemplateBytes).
+			WithTemplate(testFile2, templateObj)
+
+		// when
+		_, diffErr := sut.ExecuteDiff()
+		applyErr := sut.ExecuteApply()
+
+		// then
+		require.NoError(t, diffErr)
+		require.NoError(t, applyErr)
+		assert.Equal(t, multiDocYamlTemplateBytes, sut.fileToGenericResource[testFile2])
+		mockedApplier.AssertExpectations(t)
+	})
+}
+
+func TestBuilder_ExecuteDelete(t *testing.T) {
+	t.Run("should delete resources in reverse dependency order", func(t *testing.T) {
+		// given
+		expectedNamespaceDoc := YamlDocument(`apiVersion: v1
+kind: Namespace
+metadata:
+  labels:
+    something: important
+  name: le-namespace
+`)
+		expectedServiceAccountDoc := YamlDocument(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: le-service-account
+`)
+		expectedOptions := DeleteOptions{PropagationPolicy: metav1.DeletePropagationBackground}
+		mockedApplier := &mockApplier{}
+		serviceAccountCall := mockedApplier.On("DeleteContext", mock.Anything, expectedServiceAccountDoc, testNamespace, expectedOptions).
+			Return(nil).Once()
+		mockedApplier.On("DeleteContext", mock.Anything, expectedNamespaceDoc, testNamespace, expectedOptions).
+			Return(nil).Once().NotBefore(serviceAccountCall)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			WithDeletePropagation(metav1.DeletePropagationBackground).
+			ExecuteDelete()
+
+		// then
+		require.NoError(t, err)
+		mockedApplier.AssertExpectations(t)
+	})
+	t.Run("should only delete filtered resources", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("DeleteContext", mock.Anything, mock.Anything, testNamespace, DeleteOptions{}).Return(nil).Once()
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			WithApplyFilter(&predicatedServiceAccountCollector{}).
+			ExecuteDelete()
+
+		// then
+		require.NoError(t, err)
+		mockedApplier.AssertExpectations(t)
+	})
+	t.Run("should fail to delete", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("DeleteContext", mock.Anything, mock.Anything, testNamespace, DeleteOptions{}).Return(assert.AnError)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, singleDocYamlBytes).
+			ExecuteDelete()
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "resource deletion failed for file /dir/file1.yaml")
+	})
+}
+
 type predicatedNamespaceCollector struct {
 	collected []YamlDocument
 }
@@ -541,3 +1372,192 @@ func (m *mockApplier) ApplyWithOwner(doc YamlDocument, namespace string, resourc
 	args := m.Called(doc, namespace, resource)
 	return args.Error(0)
 }
+
+func (m *mockApplier) ApplyWithOptions(ctx context.Context, doc YamlDocument, namespace string, opts ApplyOptions) (*ResourceResult, error) {
+	args := m.Called(ctx, doc, namespace, opts)
+	applied, _ := args.Get(0).(*ResourceResult)
+	return applied, args.Error(1)
+}
+
+func (m *mockApplier) Diff(ctx context.Context, doc YamlDocument, namespace string, opts ApplyOptions) (*ResourceDiff, error) {
+	args := m.Called(ctx, doc, namespace, opts)
+	diff, _ := args.Get(0).(*ResourceDiff)
+	return diff, args.Error(1)
+}
+
+func (m *mockApplier) Prune(ctx context.Context, applySetID string, opts PruneOptions) ([]*unstructured.Unstructured, error) {
+	args := m.Called(ctx, applySetID, opts)
+	pruned, _ := args.Get(0).([]*unstructured.Unstructured)
+	return pruned, args.Error(1)
+}
+
+func (m *mockApplier) ApplySetNamespaces(ctx context.Context, parentName, parentNamespace string) ([]string, error) {
+	args := m.Called(ctx, parentName, parentNamespace)
+	namespaces, _ := args.Get(0).([]string)
+	return namespaces, args.Error(1)
+}
+
+func (m *mockApplier) ReadInventory(ctx context.Context, target InventoryTarget) (*Inventory, error) {
+	args := m.Called(ctx, target)
+	inventory, _ := args.Get(0).(*Inventory)
+	return inventory, args.Error(1)
+}
+
+func (m *mockApplier) ResolveInventoryEntry(ctx context.Context, doc YamlDocument, namespace string, opts ApplyOptions) (InventoryEntry, error) {
+	args := m.Called(ctx, doc, namespace, opts)
+	return args.Get(0).(InventoryEntry), args.Error(1)
+}
+
+func (m *mockApplier) DeleteContext(ctx context.Context, doc YamlDocument, namespace string, opts DeleteOptions) error {
+	args := m.Called(ctx, doc, namespace, opts)
+	return args.Error(0)
+}
+
+func (m *mockApplier) WaitForReady(ctx context.Context, resources []*unstructured.Unstructured, opts WaitOptions) ([]ResourceStatus, error) {
+	args := m.Called(ctx, resources, opts)
+	statuses, _ := args.Get(0).([]ResourceStatus)
+	return statuses, args.Error(1)
+}
+
+func TestBuilder_documentNamespace(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   NamespacePolicy
+		declared string
+		expected string
+	}{
+		{name: "should enforce the builder's namespace", policy: NamespacePolicyEnforce, declared: "declared", expected: testNamespace},
+		{name: "should keep the declared namespace", policy: NamespacePolicyDefault, declared: "declared", expected: "declared"},
+		{name: "should default to the builder's namespace", policy: NamespacePolicyDefault, expected: testNamespace},
+		{name: "should fall back to the builder's namespace on mismatch", policy: NamespacePolicyRejectMismatch, declared: "declared", expected: testNamespace},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			header := &documentHeader{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}}
+			header.Metadata.Namespace = tt.declared
+			sut := NewBuilder(&mockApplier{}).WithNamespace(testNamespace).WithNamespacePolicy(tt.policy)
+
+			// when
+			actual := sut.documentNamespace(header)
+
+			// then
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+
+	t.Run("should use the namespace policy of the Applier", func(t *testing.T) {
+		// given
+		header := &documentHeader{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}}
+		header.Metadata.Namespace = "declared"
+		applier := (&Applier{}).WithNamespacePolicy(NamespacePolicyDefault)
+		sut := NewBuilder(applier).WithNamespace(testNamespace)
+
+		// when
+		actual := sut.documentNamespace(header)
+
+		// then
+		assert.Equal(t, "declared", actual)
+	})
+	t.Run("should prefer the namespace policy of the Builder", func(t *testing.T) {
+		// given
+		header := &documentHeader{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}}
+		header.Metadata.Namespace = "declared"
+		applier := (&Applier{}).WithNamespacePolicy(NamespacePolicyDefault)
+		sut := NewBuilder(applier).WithNamespace(testNamespace).WithNamespacePolicy(NamespacePolicyEnforce)
+
+		// when
+		actual := sut.documentNamespace(header)
+
+		// then
+		assert.Equal(t, testNamespace, actual)
+	})
+}
+
+// minimalApplier only implements the method which NewBuilder requires.
+type minimalApplier struct {
+	mock.Mock
+}
+
+func (m *minimalApplier) ApplyWithOwner(doc YamlDocument, namespace string, resource metav1.Object) error {
+	args := m.Called(doc, namespace, resource)
+	return args.Error(0)
+}
+
+func TestBuilder_minimalApplier(t *testing.T) {
+	t.Run("should apply with ApplyWithOwner", func(t *testing.T) {
+		// given
+		owner := &v1.ConfigMap{}
+		mockedApplier := &minimalApplier{}
+		mockedApplier.On("ApplyWithOwner", mock.Anything, testNamespace, owner).Return(nil).Twice()
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		actual, err := sut.WithNamespace(testNamespace).
+			WithOwner(owner).
+			WithYamlResource(testFile1, multiDocYamlBytes).
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.NoError(t, err)
+		assert.Len(t, actual.Documents, 2)
+		mockedApplier.AssertExpectations(t)
+	})
+	t.Run("should fail for features which require further methods", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			execute func(sut *Builder) error
+			method  string
+		}{
+			{
+				name:    "dry-run",
+				execute: func(sut *Builder) error { return sut.WithDryRun().ExecuteApply() },
+				method:  "ApplyWithOptions",
+			},
+			{
+				name:    "prune",
+				execute: func(sut *Builder) error { return sut.WithPrune(testApplySetName).ExecuteApply() },
+				method:  "Prune",
+			},
+			{
+				name:    "wait",
+				execute: func(sut *Builder) error { return sut.WithWait(time.Second).ExecuteApply() },
+				method:  "WaitForReady",
+			},
+			{
+				name:    "diff",
+				execute: func(sut *Builder) error { _, err := sut.ExecuteDiff(); return err },
+				method:  "Diff",
+			},
+			{
+				name:    "delete",
+				execute: func(sut *Builder) error { return sut.ExecuteDelete() },
+				method:  "DeleteContext",
+			},
+			{
+				name: "inventory",
+				execute: func(sut *Builder) error {
+					_, err := sut.WithInventory(InventoryTarget{}).CompareInventory(context.Background())
+					return err
+				},
+				method: "ReadInventory",
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				// given
+				mockedApplier := &minimalApplier{}
+				sut := NewBuilder(mockedApplier).WithNamespace(testNamespace).WithYamlResource(testFile1, singleDocYamlBytes)
+
+				// when
+				err := tt.execute(sut)
+
+				// then
+				require.Error(t, err)
+				assert.ErrorContains(t, err, "applier *apply.minimalApplier does not implement "+tt.method)
+				mockedApplier.AssertNotCalled(t, "ApplyWithOwner", mock.Anything, mock.Anything, mock.Anything)
+			})
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package apply
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// splitIntoTiers groups consecutive documents of the same kind priority. The documents must already be sorted with
+// sortDocumentsByKind. Documents of the same tier do not depend on each other and may be applied concurrently.
+func splitIntoTiers(docs []sourceDocument) ([][]sourceDocument, error) {
+	tiers := make([][]sourceDocument, 0)
+	lastPriority := 0
+	for i, doc := range docs {
+		header, err := parseDocumentHeader(doc.doc)
+		if err != nil {
+			return nil, err
+		}
+
+		priority := kindPriority(header.Kind)
+		if i == 0 || priority != lastPriority {
+			tiers = append(tiers, make([]sourceDocument, 0))
+		}
+		tiers[len(tiers)-1] = append(tiers[len(tiers)-1], doc)
+		lastPriority = priority
+	}
+
+	return tiers, nil
+}
+
+// processDocumentsConcurrently processes the documents of each tier with up to concurrency workers. A tier is always
+// processed completely before the next tier starts. If documents of a tier fail, the following tiers are skipped and
+// the errors are joined in document order so that the returned error does not depend on scheduling.
+func processDocumentsConcurrently(ctx context.Context, tiers [][]sourceDocument, concurrency int, process func(ctx context.Context, doc sourceDocument) error) error {
+	for t, tier := range tiers {
+		errs := make([]error, len(tier))
+		workers := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+
+		for i, doc := range tier {
+			wg.Add(1)
+			workers <- struct{}{}
+			go func(i int, doc sourceDocument) {
+				defer wg.Done()
+				defer func() { <-workers }()
+
+				if ctx.Err() != nil {
+					errs[i] = ctx.Err()
+					return
+				}
+				errs[i] = process(ctx, doc)
+			}(i, doc)
+		}
+		wg.Wait()
+
+		var failures []error
+		var unapplied []sourceDocument
+		var ctxErr error
+		for i, err := range errs {
+			switch {
+			case err == nil:
+				continue
+			case isContextError(err):
+				unapplied = append(unapplied, tier[i])
+				if ctxErr == nil {
+					ctxErr = err
+				}
+			default:
+				failures = append(failures, err)
+			}
+		}
+
+		if ctxErr != nil {
+			for _, remainingTier := range tiers[t+1:] {
+				unapplied = append(unapplied, remainingTier...)
+			}
+			failures = append(failures, newUnappliedDocumentsError(ctxErr, unapplied))
+		}
+
+		switch len(failures) {
+		case 0:
+			continue
+		case 1:
+			return failures[0]
+		default:
+			return errors.Join(failures...)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_splitIntoTiers(t *testing.T) {
+	// given
+	docs := []sourceDocument{
+		newKindDocument(0, "Namespace"),
+		newKindDocument(1, "ServiceAccount"),
+		newKindDocument(2, "ServiceAccount"),
+		newKindDocument(3, "Deployment"),
+		newKindDocument(4, "MyCustomResource"),
+		newKindDocument(5, "OtherCustomResource"),
+	}
+
+	// when
+	actual, err := splitIntoTiers(docs)
+
+	// then
+	require.NoError(t, err)
+	require.Len(t, actual, 4)
+	assert.Equal(t, []int{0}, documentIndexes(actual[0]))
+	assert.Equal(t, []int{1, 2}, documentIndexes(actual[1]))
+	assert.Equal(t, []int{3}, documentIndexes(actual[2]))
+	assert.Equal(t, []int{4, 5}, documentIndexes(actual[3]))
+}
+
+func Test_processDocumentsConcurrently(t *testing.T) {
+	tiers := [][]sourceDocument{
+		{newKindDocument(0, "ServiceAccount"), newKindDocument(1, "ServiceAccount"), newKindDocument(2, "ServiceAccount")},
+		{newKindDocument(3, "Deployment")},
+	}
+
+	t.Run("should process all documents", func(t *testing.T) {
+		// given
+		var mutex sync.Mutex
+		processed := make(map[int]bool)
+
+		// when
+		err := processDocumentsConcurrently(context.Background(), tiers, 2, func(ctx context.Context, doc sourceDocument) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			processed[doc.Index] = true
+			return nil
+		})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, map[int]bool{0: true, 1: true, 2: true, 3: true}, processed)
+	})
+	t.Run("should join the errors of a tier in document order and skip later tiers", func(t *testing.T) {
+		// given
+		var mutex sync.Mutex
+		processed := make(map[int]bool)
+
+		// when
+		err := processDocumentsConcurrently(context.Background(), tiers, 3, func(ctx context.Context, doc sourceDocument) error {
+			mutex.Lock()
+			processed[doc.Index] = true
+			mutex.Unlock()
+			if doc.Index == 1 {
+				return nil
+			}
+			return fmt.Errorf("failed %s", doc.DocumentReference)
+		})
+
+		// then
+		require.Error(t, err)
+		assert.Equal(t, "failed /dir/file1.yaml[0]\nfailed /dir/file1.yaml[2]", err.Error())
+		assert.False(t, processed[3])
+	})
+	t.Run("should report unapplied documents on cancellation", func(t *testing.T) {
+		// given
+		ctx, cancel := context.WithCancel(context.Background())
+
+		// when
+		err := processDocumentsConcurrently(ctx, tiers, 1, func(ctx context.Context, doc sourceDocument) error {
+			cancel()
+			return nil
+		})
+
+		// then
+		require.Error(t, err)
+		var unappliedErr *UnappliedDocumentsError
+		require.ErrorAs(t, err, &unappliedErr)
+		assert.ErrorIs(t, err, context.Canceled)
+		expected := []DocumentReference{{Filename: testFile1, Index: 1}, {Filename: testFile1, Index: 2}, {Filename: testFile1, Index: 3}}
+		assert.Equal(t, expected, unappliedErr.Unapplied())
+	})
+}
+
+type countingCollector struct {
+	collected int
+}
+
+func (c *countingCollector) Predicate(YamlDocument) (bool, error) {
+	return true, nil
+}
+
+func (c *countingCollector) Collect(YamlDocument) {
+	// not synchronized on purpose, the race detector reports concurrent calls
+	c.collected++
+}
+
+func TestBuilder_ExecuteApplyWithResult_concurrency(t *testing.T) {
+	t.Run("should apply concurrently and list documents in order", func(t *testing.T) {
+		// given
+		var docs []byte
+		mockedApplier := &mockApplier{}
+		for i := 0; i < 10; i++ {
+			doc := fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm-%d\n", i)
+			docs = append(docs, []byte(doc+"---\n")...)
+			mockedApplier.On("ApplyWithOptions", mock.Anything, YamlDocument(doc), testNamespace, ApplyOptions{}).
+				Return(&ResourceResult{Object: newUnstructuredFromYaml(t, doc)}, nil)
+		}
+		collector := &countingCollector{}
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		actual, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, docs).
+			WithCollector(collector).
+			WithConcurrency(4).
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 10, collector.collected)
+		require.Len(t, actual.Documents, 10)
+		for i, doc := range actual.Documents {
+			assert.Equal(t, i, doc.Index)
+			assert.Equal(t, fmt.Sprintf("cm-%d", i), doc.Object.GetName())
+		}
+	})
+	t.Run("should return errors of all failed documents", func(t *testing.T) {
+		// given
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", mock.Anything, mock.Anything, testNamespace, ApplyOptions{}).
+			Return(nil, assert.AnError)
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		_, err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, []byte("apiVersion: v1\nkind: ConfigMap\n---\napiVersion: v1\nkind: ConfigMap\n")).
+			WithYamlResource(testFile2, []byte("apiVersion: v1\nkind: ConfigMap\n")).
+			WithConcurrency(2).
+			ExecuteApplyWithResult(context.Background())
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		failure := ": " + assert.AnError.Error()
+		expected := "resource application failed for file /dir/file1.yaml" + failure + "\n" +
+			"resource application failed for file /dir/file1.yaml" + failure + "\n" +
+			"resource application failed for file /dir/file2.yaml" + failure
+		assert.Equal(t, expected, err.Error())
+	})
+}
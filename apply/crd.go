@@ -0,0 +1,138 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	defaultCRDEstablishTimeout  = 30 * time.Second
+	defaultCRDEstablishInterval = 500 * time.Millisecond
+)
+
+var (
+	crdGroupKind = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+	crdResource  = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+)
+
+// WithCRDEstablishTimeout sets how long the Applier waits for a CustomResourceDefinition it applied before to become
+// established when a custom resource of this definition is applied. It defaults to 30 seconds.
+func (ac *Applier) WithCRDEstablishTimeout(timeout time.Duration) *Applier {
+	ac.crdEstablishTimeout = timeout
+
+	return ac
+}
+
+// trackAppliedCRD remembers the kind defined by an applied CRD so that resources of this kind can wait for the CRD
+// to become established.
+func (ac *Applier) trackAppliedCRD(crd *unstructured.Unstructured) {
+	if crd.GroupVersionKind().GroupKind() != crdGroupKind {
+		return
+	}
+
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	if kind == "" {
+		return
+	}
+
+	ac.crdMutex.Lock()
+	defer ac.crdMutex.Unlock()
+	if ac.appliedCRDs == nil {
+		ac.appliedCRDs = make(map[schema.GroupKind]string)
+	}
+	ac.appliedCRDs[schema.GroupKind{Group: group, Kind: kind}] = crd.GetName()
+}
+
+func (ac *Applier) appliedCRDName(gk schema.GroupKind) (string, bool) {
+	ac.crdMutex.Lock()
+	defer ac.crdMutex.Unlock()
+
+	name, ok := ac.appliedCRDs[gk]
+	return name, ok
+}
+
+func (ac *Applier) forgetAppliedCRD(gk schema.GroupKind) {
+	ac.crdMutex.Lock()
+	defer ac.crdMutex.Unlock()
+
+	delete(ac.appliedCRDs, gk)
+}
+
+// retryRESTMapping is called when the mapper does not know the given kind. The discovery cache of the mapper is reset
+// so that kinds of recently created CRDs are found. If the kind is defined by a CRD which was applied by this Applier,
+// the mapping is retried until the CRD is established or the CRD establish timeout is exceeded.
+func (ac *Applier) retryRESTMapping(ctx context.Context, gk schema.GroupKind, version string, noMatchErr error) (*meta.RESTMapping, error) {
+	resettable, ok := ac.gvrMapper.(meta.ResettableRESTMapper)
+	if !ok {
+		return nil, noMatchErr
+	}
+
+	crdName, ok := ac.appliedCRDName(gk)
+	if !ok {
+		resettable.Reset()
+		return ac.gvrMapper.RESTMapping(gk, version)
+	}
+
+	timeout := ac.crdEstablishTimeout
+	if timeout <= 0 {
+		timeout = defaultCRDEstablishTimeout
+	}
+	interval := ac.crdEstablishInterval
+	if interval <= 0 {
+		interval = defaultCRDEstablishInterval
+	}
+
+	ac.log().Debugf("Waiting for CRD %s to become established", crdName)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var mapping *meta.RESTMapping
+	err := wait.PollImmediateUntilWithContext(waitCtx, interval, func(ctx context.Context) (bool, error) {
+		established, err := ac.isCRDEstablished(ctx, crdName)
+		if err != nil || !established {
+			return false, err
+		}
+
+		resettable.Reset()
+		mapping, err = ac.gvrMapper.RESTMapping(gk, version)
+		if meta.IsNoMatchError(err) {
+			return false, nil
+		}
+
+		return err == nil, err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if waitCtx.Err() != nil {
+			return nil, fmt.Errorf("CRD %s was not established within %s: %w", crdName, timeout, noMatchErr)
+		}
+		return nil, err
+	}
+
+	ac.forgetAppliedCRD(gk)
+	return mapping, nil
+}
+
+func (ac *Applier) isCRDEstablished(ctx context.Context, name string) (bool, error) {
+	crd, err := ac.dynClient.Resource(crdResource).Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, NewResourceError(err, "error while fetching CRD", crdGroupKind.Kind, crdResource.GroupVersion().String(), name)
+	}
+
+	status, _ := crdReadiness(crd)
+	return status == ReadinessStatusReady, nil
+}
@@ -0,0 +1,129 @@
+package apply
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type resettableGvrMapper struct {
+	*mockGvrMapper
+	resets int
+}
+
+func (m *resettableGvrMapper) Reset() {
+	m.resets++
+}
+
+const testCRDDoc = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: dogus.k8s.cloudogu.com
+spec:
+  group: k8s.cloudogu.com
+  names:
+    kind: Dogu
+`
+
+var (
+	testDoguGroupKind = schema.GroupKind{Group: "k8s.cloudogu.com", Kind: "Dogu"}
+	testDoguMapping   = &meta.RESTMapping{
+		Resource:         schema.GroupVersionResource{Group: "k8s.cloudogu.com", Version: "v1", Resource: "dogus"},
+		GroupVersionKind: schema.GroupVersionKind{Group: "k8s.cloudogu.com", Version: "v1", Kind: "Dogu"},
+		Scope:            meta.RESTScopeNamespace,
+	}
+	testDoguNoMatch = &meta.NoKindMatchError{GroupKind: testDoguGroupKind, SearchedVersions: []string{"v1"}}
+)
+
+func TestApplier_trackAppliedCRD(t *testing.T) {
+	t.Run("should track the kind of a CRD", func(t *testing.T) {
+		sut := &Applier{}
+
+		sut.trackAppliedCRD(newUnstructuredFromYaml(t, testCRDDoc))
+
+		name, ok := sut.appliedCRDName(testDoguGroupKind)
+		assert.True(t, ok)
+		assert.Equal(t, "dogus.k8s.cloudogu.com", name)
+	})
+	t.Run("should ignore other kinds", func(t *testing.T) {
+		sut := &Applier{}
+
+		sut.trackAppliedCRD(newUnstructuredFromYaml(t, testServiceAccountDoc))
+
+		assert.Empty(t, sut.appliedCRDs)
+	})
+}
+
+func TestApplier_restMapping(t *testing.T) {
+	establishedCRD := newUnstructuredFromYaml(t, testCRDDoc+`status:
+  conditions: [{type: Established, status: "True"}]`)
+	pendingCRD := newUnstructuredFromYaml(t, testCRDDoc)
+
+	t.Run("should wait for an applied CRD and reset the discovery cache", func(t *testing.T) {
+		// given
+		gvrMapperMock := &resettableGvrMapper{mockGvrMapper: newMockGvrMapper(t)}
+		gvrMapperMock.EXPECT().RESTMapping(testDoguGroupKind, "v1").Return(nil, testDoguNoMatch).Once()
+		gvrMapperMock.EXPECT().RESTMapping(testDoguGroupKind, "v1").Return(testDoguMapping, nil).Once()
+
+		apiInterfaceMock := newMockNamespaceInterface(t)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "dogus.k8s.cloudogu.com", metav1.GetOptions{}).Return(pendingCRD, nil).Once()
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "dogus.k8s.cloudogu.com", metav1.GetOptions{}).Return(establishedCRD, nil).Once()
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(crdResource).Return(apiInterfaceMock)
+
+		sut := &Applier{gvrMapper: gvrMapperMock, dynClient: dynClientMock, crdEstablishInterval: time.Millisecond}
+		sut.trackAppliedCRD(pendingCRD)
+
+		// when
+		actual, err := sut.restMapping(context.Background(), testDoguGroupKind, "v1")
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, testDoguMapping, actual)
+		assert.Equal(t, 1, gvrMapperMock.resets)
+		assert.Empty(t, sut.appliedCRDs)
+	})
+	t.Run("should fail if the CRD is not established in time", func(t *testing.T) {
+		// given
+		gvrMapperMock := &resettableGvrMapper{mockGvrMapper: newMockGvrMapper(t)}
+		gvrMapperMock.EXPECT().RESTMapping(testDoguGroupKind, "v1").Return(nil, testDoguNoMatch).Once()
+
+		apiInterfaceMock := newMockNamespaceInterface(t)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "dogus.k8s.cloudogu.com", metav1.GetOptions{}).Return(pendingCRD, nil)
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(crdResource).Return(apiInterfaceMock)
+
+		sut := &Applier{gvrMapper: gvrMapperMock, dynClient: dynClientMock, crdEstablishInterval: time.Millisecond}
+		sut.WithCRDEstablishTimeout(20 * time.Millisecond).trackAppliedCRD(pendingCRD)
+
+		// when
+		_, err := sut.restMapping(context.Background(), testDoguGroupKind, "v1")
+
+		// then
+		require.Error(t, err)
+		assert.True(t, meta.IsNoMatchError(err))
+		assert.ErrorContains(t, err, "CRD dogus.k8s.cloudogu.com was not established within 20ms")
+	})
+	t.Run("should reset the discovery cache once for unknown kinds", func(t *testing.T) {
+		// given
+		gvrMapperMock := &resettableGvrMapper{mockGvrMapper: newMockGvrMapper(t)}
+		gvrMapperMock.EXPECT().RESTMapping(testDoguGroupKind, "v1").Return(nil, testDoguNoMatch).Twice()
+
+		sut := &Applier{gvrMapper: gvrMapperMock}
+
+		// when
+		_, err := sut.restMapping(context.Background(), testDoguGroupKind, "v1")
+
+		// then
+		require.Error(t, err)
+		assert.True(t, meta.IsNoMatchError(err))
+		assert.Equal(t, 1, gvrMapperMock.resets)
+	})
+}
@@ -0,0 +1,79 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DeleteOptions contains optional settings which control how a single YAML document is deleted.
+type DeleteOptions struct {
+	// PropagationPolicy decides whether and how dependents are garbage-collected. The API server's default policy for
+	// the resource is used if it is empty.
+	PropagationPolicy metav1.DeletionPropagation
+	// DryRun sends the request as server-side dry-run.
+	DryRun bool
+	// NamespacePolicy decides whether a namespace declared in the document is kept, see ApplyOptions.
+	NamespacePolicy NamespacePolicy
+}
+
+// Delete sends a request to the K8s API in order to delete the provided YAML resource from the current cluster.
+// Resources which do not exist (anymore) are considered as deleted.
+func (ac *Applier) Delete(yamlResource YamlDocument, namespace string, opts DeleteOptions) error {
+	return ac.DeleteContext(context.Background(), yamlResource, namespace, opts)
+}
+
+// DeleteContext works like Delete but aborts once the given context is cancelled or exceeds its deadline. List kinds
+// and JSON arrays are expanded like in ApplyWithOwnerContext and their items are deleted in reverse order.
+func (ac *Applier) DeleteContext(ctx context.Context, yamlResource YamlDocument, namespace string, opts DeleteOptions) error {
+	items, isList, err := expandDocument(yamlResource)
+	if err != nil {
+		return fmt.Errorf("could not expand list document: %w", err)
+	}
+	if !isList {
+		return ac.deleteResource(ctx, yamlResource, namespace, opts)
+	}
+
+	for i := len(items) - 1; i >= 0; i-- {
+		err = ac.deleteResource(ctx, items[i], namespace, opts)
+		if err != nil {
+			return fmt.Errorf("could not delete item %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (ac *Applier) deleteResource(ctx context.Context, yamlResource YamlDocument, namespace string, opts DeleteOptions) error {
+	ac.log().Debug("Deleting K8s resource")
+	ac.log().Debug(string(yamlResource))
+
+	k8sObjects, _, dr, err := ac.prepareResource(ctx, yamlResource, namespace, ApplyOptions{NamespacePolicy: opts.NamespacePolicy})
+	if meta.IsNoMatchError(err) {
+		// without a matching kind in the cluster there cannot be any resource of this kind
+		ac.log().Debug(fmt.Sprintf("Skipping deletion of resource with unknown kind: %v", err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	deleteOptions := metav1.DeleteOptions{}
+	if opts.PropagationPolicy != "" {
+		deleteOptions.PropagationPolicy = &opts.PropagationPolicy
+	}
+	if opts.DryRun {
+		deleteOptions.DryRun = []string{metav1.DryRunAll}
+	}
+
+	ac.log().Debug(fmt.Sprintf("Deleting resource %s/%s/%s", k8sObjects.GetKind(), k8sObjects.GetAPIVersion(), k8sObjects.GetName()))
+	err = dr.Delete(ctx, k8sObjects.GetName(), deleteOptions)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return NewResourceError(err, "error while deleting", k8sObjects.GetKind(), k8sObjects.GetAPIVersion(), k8sObjects.GetName())
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const testServiceAccountDoc = `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: le-service-account`
+
+func TestApplier_Delete(t *testing.T) {
+	t.Run("should delete with propagation policy", func(t *testing.T) {
+		// given
+		foreground := metav1.DeletePropagationForeground
+		sut, apiInterfaceMock := newMappedApplier(t, testServiceAccountMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Delete(mock.Anything, "le-service-account", metav1.DeleteOptions{PropagationPolicy: &foreground}).Return(nil)
+
+		// when
+		err := sut.Delete(YamlDocument(testServiceAccountDoc), testNamespace, DeleteOptions{PropagationPolicy: foreground})
+
+		// then
+		require.NoError(t, err)
+	})
+	t.Run("should send a dry-run", func(t *testing.T) {
+		// given
+		sut, apiInterfaceMock := newMappedApplier(t, testServiceAccountMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Delete(mock.Anything, "le-service-account", metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}}).Return(nil)
+
+		// when
+		err := sut.Delete(YamlDocument(testServiceAccountDoc), testNamespace, DeleteOptions{DryRun: true})
+
+		// then
+		require.NoError(t, err)
+	})
+	t.Run("should succeed for a resource which does not exist", func(t *testing.T) {
+		// given
+		notFound := k8serrors.NewNotFound(schema.GroupResource{Resource: "serviceaccounts"}, "le-service-account")
+		sut, apiInterfaceMock := newMappedApplier(t, testServiceAccountMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Delete(mock.Anything, "le-service-account", metav1.DeleteOptions{}).Return(notFound)
+
+		// when
+		err := sut.Delete(YamlDocument(testServiceAccountDoc), testNamespace, DeleteOptions{})
+
+		// then
+		require.NoError(t, err)
+	})
+	t.Run("should succeed for a kind which does not exist", func(t *testing.T) {
+		// given
+		gvrMapperMock := newMockGvrMapper(t)
+		noMatch := &meta.NoKindMatchError{GroupKind: schema.GroupKind{Kind: "ServiceAccount"}, SearchedVersions: []string{"v1"}}
+		gvrMapperMock.EXPECT().RESTMapping(schema.GroupKind{Kind: "ServiceAccount"}, "v1").Return(nil, noMatch)
+
+		sut := &Applier{gvrMapper: gvrMapperMock}
+
+		// when
+		err := sut.Delete(YamlDocument(testServiceAccountDoc), testNamespace, DeleteOptions{})
+
+		// then
+		require.NoError(t, err)
+	})
+	t.Run("should fail to delete", func(t *testing.T) {
+		// given
+		sut, apiInterfaceMock := newMappedApplier(t, testServiceAccountMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Delete(mock.Anything, "le-service-account", metav1.DeleteOptions{}).Return(assert.AnError)
+
+		// when
+		err := sut.DeleteContext(context.Background(), YamlDocument(testServiceAccountDoc), testNamespace, DeleteOptions{})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "error while deleting (resource ServiceAccount/v1/le-service-account)")
+	})
+	t.Run("should delete the items of a list in reverse order", func(t *testing.T) {
+		// given
+		var deleted []string
+		sut, apiInterfaceMock := newMappedApplier(t, testServiceAccountMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Delete(mock.Anything, mock.Anything, metav1.DeleteOptions{}).
+			RunAndReturn(func(_ context.Context, name string, _ metav1.DeleteOptions, _ ...string) error {
+				deleted = append(deleted, name)
+				return nil
+			})
+		list := YamlDocument(`apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ServiceAccount
+  metadata:
+    name: first
+- apiVersion: v1
+  kind: ServiceAccount
+  metadata:
+    name: second`)
+
+		// when
+		err := sut.Delete(list, testNamespace, DeleteOptions{})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []string{"second", "first"}, deleted)
+	})
+	t.Run("should fail to expand an invalid list", func(t *testing.T) {
+		// when
+		err := (&Applier{}).Delete(YamlDocument(`[{"kind": `), testNamespace, DeleteOptions{})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "could not expand list document")
+	})
+}
@@ -0,0 +1,128 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pmezard/go-difflib/difflib"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// DiffStatus describes how an apply would affect a single resource.
+type DiffStatus string
+
+const (
+	// DiffStatusCreated marks a resource that does not exist yet and would be created.
+	DiffStatusCreated DiffStatus = "created"
+	// DiffStatusChanged marks an existing resource that would be modified.
+	DiffStatusChanged DiffStatus = "changed"
+	// DiffStatusUnchanged marks an existing resource that would stay as it is.
+	DiffStatusUnchanged DiffStatus = "unchanged"
+)
+
+// ResourceDiff describes the changes an apply would make to a single resource.
+type ResourceDiff struct {
+	// DocumentReference identifies the YAML document the resource originates from. It is only set by the Builder.
+	DocumentReference
+	// GroupVersionKind identifies the type of the resource.
+	GroupVersionKind schema.GroupVersionKind
+	// Namespace contains the namespace of the resource. It is empty for cluster-scoped resources.
+	Namespace string
+	// Name contains the name of the resource.
+	Name string
+	// Status tells whether the resource would be created, changed or left unchanged.
+	Status DiffStatus
+	// Diff contains a unified diff between the live and the desired resource in YAML. The fields metadata.managedFields
+	// and status are omitted on both sides. Diff is empty for unchanged resources.
+	Diff string
+}
+
+// Diff compares the provided YAML resource with its live counterpart in the cluster. The desired state is computed by
+// a server-side dry-run apply with the configured field manager so that defaulting and admission are taken into
+// account. Nothing is persisted.
+func (ac *Applier) Diff(ctx context.Context, yamlResource YamlDocument, namespace string, opts ApplyOptions) (*ResourceDiff, error) {
+	ac.log().Debug("Diffing K8s resource")
+	ac.log().Debug(string(yamlResource))
+
+	desiredResource, _, dr, err := ac.prepareResource(ctx, yamlResource, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := dr.Get(ctx, desiredResource.GetName(), metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, NewResourceError(err, "error while fetching live resource", desiredResource.GetKind(), desiredResource.GetAPIVersion(), desiredResource.GetName())
+	}
+	if k8serrors.IsNotFound(err) {
+		live = nil
+	}
+
+	merged, err := ac.createOrUpdateResource(ctx, desiredResource, dr, true)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := diffResources(live, merged)
+	if err != nil {
+		return nil, NewResourceError(err, "error while diffing", desiredResource.GetKind(), desiredResource.GetAPIVersion(), desiredResource.GetName())
+	}
+
+	result := &ResourceDiff{
+		GroupVersionKind: desiredResource.GroupVersionKind(),
+		Namespace:        desiredResource.GetNamespace(),
+		Name:             desiredResource.GetName(),
+		Diff:             diff,
+	}
+	switch {
+	case live == nil:
+		result.Status = DiffStatusCreated
+	case diff == "":
+		result.Status = DiffStatusUnchanged
+	default:
+		result.Status = DiffStatusChanged
+	}
+
+	return result, nil
+}
+
+func diffResources(live, merged *unstructured.Unstructured) (string, error) {
+	liveYaml, err := toComparableYaml(live)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal live resource: %w", err)
+	}
+	mergedYaml, err := toComparableYaml(merged)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal desired resource: %w", err)
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(liveYaml),
+		B:        difflib.SplitLines(mergedYaml),
+		FromFile: "live",
+		ToFile:   "desired",
+		Context:  3,
+	})
+}
+
+// toComparableYaml marshals the resource without the fields which change with every request or are not part of the
+// desired state.
+func toComparableYaml(resource *unstructured.Unstructured) (string, error) {
+	if resource == nil {
+		return "", nil
+	}
+
+	stripped := resource.DeepCopy()
+	unstructured.RemoveNestedField(stripped.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(stripped.Object, "status")
+
+	out, err := yaml.Marshal(stripped.Object)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
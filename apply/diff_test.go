@@ -0,0 +1,115 @@
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const testConfigMapDoc = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: le-config-map
+data:
+  key: new-value`
+
+var dryRunPatchOptions = metav1.PatchOptions{FieldManager: testFieldManagerName, DryRun: []string{metav1.DryRunAll}}
+
+func newTestConfigMap(value string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":          "le-config-map",
+			"namespace":     testNamespace,
+			"managedFields": []interface{}{map[string]interface{}{"manager": testFieldManagerName}},
+		},
+		"data": map[string]interface{}{"key": value},
+	}}
+}
+
+func TestApplier_Diff(t *testing.T) {
+	t.Run("should report a resource which does not exist yet as created", func(t *testing.T) {
+		// given
+		notFound := k8serrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "le-config-map")
+		sut, apiInterfaceMock := newMappedApplier(t, testConfigMapMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "le-config-map", metav1.GetOptions{}).Return(nil, notFound)
+		apiInterfaceMock.EXPECT().Patch(mock.Anything, "le-config-map", mock.Anything, mock.Anything, dryRunPatchOptions).
+			Return(newTestConfigMap("new-value"), nil)
+
+		// when
+		actual, err := sut.Diff(context.Background(), YamlDocument(testConfigMapDoc), testNamespace, ApplyOptions{})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, DiffStatusCreated, actual.Status)
+		assert.Equal(t, schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, actual.GroupVersionKind)
+		assert.Equal(t, testNamespace, actual.Namespace)
+		assert.Equal(t, "le-config-map", actual.Name)
+		assert.Contains(t, actual.Diff, "+  key: new-value")
+		assert.NotContains(t, actual.Diff, "managedFields")
+	})
+	t.Run("should report a changed resource with a unified diff", func(t *testing.T) {
+		// given
+		sut, apiInterfaceMock := newMappedApplier(t, testConfigMapMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "le-config-map", metav1.GetOptions{}).Return(newTestConfigMap("old-value"), nil)
+		apiInterfaceMock.EXPECT().Patch(mock.Anything, "le-config-map", mock.Anything, mock.Anything, dryRunPatchOptions).
+			Return(newTestConfigMap("new-value"), nil)
+
+		// when
+		actual, err := sut.Diff(context.Background(), YamlDocument(testConfigMapDoc), testNamespace, ApplyOptions{})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, DiffStatusChanged, actual.Status)
+		expectedDiff := `--- live
++++ desired
+@@ -1,6 +1,6 @@
+ apiVersion: v1
+ data:
+-  key: old-value
++  key: new-value
+ kind: ConfigMap
+ metadata:
+   name: le-config-map
+`
+		assert.Equal(t, expectedDiff, actual.Diff)
+	})
+	t.Run("should report an unchanged resource and ignore status", func(t *testing.T) {
+		// given
+		live := newTestConfigMap("new-value")
+		live.Object["status"] = map[string]interface{}{"phase": "whatever"}
+		sut, apiInterfaceMock := newMappedApplier(t, testConfigMapMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "le-config-map", metav1.GetOptions{}).Return(live, nil)
+		apiInterfaceMock.EXPECT().Patch(mock.Anything, "le-config-map", mock.Anything, mock.Anything, dryRunPatchOptions).
+			Return(newTestConfigMap("new-value"), nil)
+
+		// when
+		actual, err := sut.Diff(context.Background(), YamlDocument(testConfigMapDoc), testNamespace, ApplyOptions{})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, DiffStatusUnchanged, actual.Status)
+		assert.Empty(t, actual.Diff)
+	})
+	t.Run("should fail to fetch the live resource", func(t *testing.T) {
+		// given
+		sut, apiInterfaceMock := newMappedApplier(t, testConfigMapMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "le-config-map", metav1.GetOptions{}).Return(nil, assert.AnError)
+
+		// when
+		_, err := sut.Diff(context.Background(), YamlDocument(testConfigMapDoc), testNamespace, ApplyOptions{})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "error while fetching live resource")
+	})
+}
@@ -0,0 +1,128 @@
+package apply
+
+import (
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// documentHeader contains the identifying fields of a YAML document which can be read without contacting the
+// Kubernetes API.
+type documentHeader struct {
+	metav1.TypeMeta `json:",inline"`
+	Metadata        struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+}
+
+func parseDocumentHeader(doc YamlDocument) (*documentHeader, error) {
+	header := &documentHeader{}
+	err := yaml.Unmarshal(doc, header)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse kind and name of YAML document '%s': %w", string(doc), err)
+	}
+
+	return header, nil
+}
+
+func (h *documentHeader) groupKind() schema.GroupKind {
+	return h.GroupVersionKind().GroupKind()
+}
+
+// installOrder lists kinds in the order in which they should be applied so that dependencies like namespaces, CRDs or
+// service accounts exist before the resources which use them. Kinds which are not listed, f. i. custom resources, are
+// applied after all listed kinds.
+var installOrder = []string{
+	"Namespace",
+	"ResourceQuota",
+	"LimitRange",
+	"PriorityClass",
+	"NetworkPolicy",
+	"PodSecurityPolicy",
+	"PodDisruptionBudget",
+	"CustomResourceDefinition",
+	"ServiceAccount",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"Secret",
+	"ConfigMap",
+	"StorageClass",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"Service",
+	"DaemonSet",
+	"Pod",
+	"ReplicationController",
+	"ReplicaSet",
+	"Deployment",
+	"HorizontalPodAutoscaler",
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"IngressClass",
+	"Ingress",
+	"APIService",
+}
+
+// lastInstalledKinds are applied after all other kinds because they may intercept requests for other resources.
+var lastInstalledKinds = []string{
+	"MutatingWebhookConfiguration",
+	"ValidatingWebhookConfiguration",
+}
+
+func kindPriority(kind string) int {
+	for i, orderedKind := range installOrder {
+		if orderedKind == kind {
+			return i
+		}
+	}
+
+	for i, lastKind := range lastInstalledKinds {
+		if lastKind == kind {
+			return len(installOrder) + 1 + i
+		}
+	}
+
+	// unknown kinds are placed between the known kinds and the last kinds
+	return len(installOrder)
+}
+
+// sortDocumentsByKind sorts the documents by the install order of their kinds. For uninstall the order is reversed.
+// Documents of the same kind keep their order.
+func sortDocumentsByKind(docs []sourceDocument, uninstall bool) ([]sourceDocument, error) {
+	type prioritizedDocument struct {
+		sourceDocument
+		priority int
+	}
+
+	prioritized := make([]prioritizedDocument, 0, len(docs))
+	for _, doc := range docs {
+		header, err := parseDocumentHeader(doc.doc)
+		if err != nil {
+			return nil, fmt.Errorf("could not determine kind of document %s: %w", doc.DocumentReference, err)
+		}
+
+		priority := kindPriority(header.Kind)
+		if uninstall {
+			priority = -priority
+		}
+		prioritized = append(prioritized, prioritizedDocument{sourceDocument: doc, priority: priority})
+	}
+
+	sort.SliceStable(prioritized, func(i, j int) bool {
+		return prioritized[i].priority < prioritized[j].priority
+	})
+
+	sorted := make([]sourceDocument, 0, len(prioritized))
+	for _, doc := range prioritized {
+		sorted = append(sorted, doc.sourceDocument)
+	}
+
+	return sorted, nil
+}
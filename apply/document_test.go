@@ -0,0 +1,63 @@
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKindDocument(index int, kind string) sourceDocument {
+	return sourceDocument{
+		DocumentReference: DocumentReference{Filename: testFile1, Index: index},
+		doc:               YamlDocument("apiVersion: v1\nkind: " + kind + "\nmetadata:\n  name: doc\n"),
+	}
+}
+
+func documentIndexes(docs []sourceDocument) []int {
+	indexes := make([]int, 0, len(docs))
+	for _, doc := range docs {
+		indexes = append(indexes, doc.Index)
+	}
+	return indexes
+}
+
+func Test_sortDocumentsByKind(t *testing.T) {
+	docs := []sourceDocument{
+		newKindDocument(0, "ValidatingWebhookConfiguration"),
+		newKindDocument(1, "Deployment"),
+		newKindDocument(2, "MyCustomResource"),
+		newKindDocument(3, "ServiceAccount"),
+		newKindDocument(4, "CustomResourceDefinition"),
+		newKindDocument(5, "Namespace"),
+		newKindDocument(6, "ServiceAccount"),
+	}
+
+	t.Run("should sort for install", func(t *testing.T) {
+		// when
+		actual, err := sortDocumentsByKind(docs, false)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []int{5, 4, 3, 6, 1, 2, 0}, documentIndexes(actual))
+	})
+	t.Run("should sort for uninstall", func(t *testing.T) {
+		// when
+		actual, err := sortDocumentsByKind(docs, true)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []int{0, 2, 1, 3, 6, 4, 5}, documentIndexes(actual))
+	})
+	t.Run("should fail for unparsable document", func(t *testing.T) {
+		// given
+		invalid := []sourceDocument{{DocumentReference: DocumentReference{Filename: testFile1}, doc: YamlDocument("[")}}
+
+		// when
+		_, err := sortDocumentsByKind(invalid, false)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "could not determine kind of document /dir/file1.yaml[0]")
+	})
+}
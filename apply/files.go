@@ -0,0 +1,131 @@
+package apply
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// manifestExtensions contains the extensions of files which are loaded by WithFS and WithDirectory.
+var manifestExtensions = []string{".yaml", ".yml", ".json"}
+
+// WithFS adds all manifest files of the given file system, f. i. an embed.FS, whose paths match one of the given
+// glob patterns. Directories which match a pattern are added with all files below them. Without patterns, all files
+// of the file system are considered. Only files ending with .yaml, .yml or .json are added, sorted by path. The paths are used as file names, f. i. for WithTemplate and in error messages.
+// Errors while reading the file system are returned by the Execute methods. This method is optional.
+func (ab *Builder) WithFS(fsys fs.FS, patterns ...string) *Builder {
+	files, err := findManifests(fsys, patterns, true)
+	if err != nil {
+		ab.loadErrors = append(ab.loadErrors, err)
+		return ab
+	}
+
+	return ab.withFiles(fsys, files, func(file string) string { return file })
+}
+
+// WithDirectory adds all manifest files of the given directory, optionally including its subdirectories. Only files
+// ending with .yaml, .yml or .json are added, sorted by path. The paths including the directory are used as file
+// names. Errors while reading the directory are returned by the Execute methods. This method is optional.
+func (ab *Builder) WithDirectory(dir string, recursive bool) *Builder {
+	fsys := os.DirFS(dir)
+	_, err := fs.Stat(fsys, ".")
+	if err != nil {
+		ab.loadErrors = append(ab.loadErrors, fmt.Errorf("could not read directory %s: %w", dir, err))
+		return ab
+	}
+
+	files, err := findManifests(fsys, nil, recursive)
+	if err != nil {
+		ab.loadErrors = append(ab.loadErrors, fmt.Errorf("could not read directory %s: %w", dir, err))
+		return ab
+	}
+
+	return ab.withFiles(fsys, files, func(file string) string { return filepath.Join(dir, filepath.FromSlash(file)) })
+}
+
+func (ab *Builder) withFiles(fsys fs.FS, files []string, filename func(file string) string) *Builder {
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			ab.loadErrors = append(ab.loadErrors, fmt.Errorf("could not read file %s: %w", filename(file), err))
+			continue
+		}
+
+		ab.WithYamlResource(filename(file), content)
+	}
+
+	return ab
+}
+
+// findManifests returns the sorted paths of all manifest files which match one of the patterns or lie in a matching
+// directory. Subdirectories of matching directories are only searched if recursive is true. Without patterns, the
+// root directory of the file system is searched.
+func findManifests(fsys fs.FS, patterns []string, recursive bool) ([]string, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	found := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+
+		for _, match := range matches {
+			info, err := fs.Stat(fsys, match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				if isManifest(match) {
+					found[match] = true
+				}
+				continue
+			}
+
+			err = findManifestsInDirectory(fsys, match, recursive, found)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	files := make([]string, 0, len(found))
+	for file := range found {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func findManifestsInDirectory(fsys fs.FS, dir string, recursive bool, found map[string]bool) error {
+	return fs.WalkDir(fsys, dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && file != dir && !recursive {
+			return fs.SkipDir
+		}
+		if !entry.IsDir() && isManifest(file) {
+			found[file] = true
+		}
+		return nil
+	})
+}
+
+func isManifest(file string) bool {
+	extension := strings.ToLower(path.Ext(file))
+	for _, manifestExtension := range manifestExtensions {
+		if extension == manifestExtension {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,109 @@
+package apply
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newManifestFS() fstest.MapFS {
+	return fstest.MapFS{
+		"base/service.yaml":      {Data: []byte("kind: Service")},
+		"base/deployment.yml":    {Data: []byte("kind: Deployment")},
+		"base/README.md":         {Data: []byte("# docs")},
+		"config.json":            {Data: []byte(`{"kind": "ConfigMap"}`)},
+		"overlay/dev/patch.YAML": {Data: []byte("kind: Patch")},
+	}
+}
+
+func TestBuilder_WithFS(t *testing.T) {
+	t.Run("should add all manifests sorted by path", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		sut.WithFS(newManifestFS())
+
+		// then
+		assert.Equal(t, []string{"base/deployment.yml", "base/service.yaml", "config.json", "overlay/dev/patch.YAML"}, sut.fileOrder)
+		assert.Equal(t, []byte("kind: Service"), sut.fileToGenericResource["base/service.yaml"])
+		assert.Empty(t, sut.loadErrors)
+	})
+	t.Run("should only add manifests matching the patterns", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		sut.WithFS(newManifestFS(), "base/*", "*.json", "base/service.yaml")
+
+		// then
+		assert.Equal(t, []string{"base/deployment.yml", "base/service.yaml", "config.json"}, sut.fileOrder)
+	})
+	t.Run("should add all manifests below matching directories", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		sut.WithFS(newManifestFS(), "overlay", "base")
+
+		// then
+		assert.Equal(t, []string{"base/deployment.yml", "base/service.yaml", "overlay/dev/patch.YAML"}, sut.fileOrder)
+		assert.Empty(t, sut.loadErrors)
+	})
+	t.Run("should return invalid patterns on execution", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		err := sut.WithFS(newManifestFS(), "[").ExecuteApply()
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "could not load manifests: invalid pattern [")
+	})
+}
+
+func TestBuilder_WithDirectory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("kind: A"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b.yaml"), []byte("kind: B"), 0o644))
+
+	t.Run("should add manifests of the directory", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		sut.WithDirectory(dir, false)
+
+		// then
+		assert.Equal(t, []string{filepath.Join(dir, "a.yaml")}, sut.fileOrder)
+	})
+	t.Run("should add manifests of subdirectories", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		sut.WithDirectory(dir, true)
+
+		// then
+		assert.Equal(t, []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "sub", "b.yaml")}, sut.fileOrder)
+		assert.Equal(t, []byte("kind: B"), sut.fileToGenericResource[filepath.Join(dir, "sub", "b.yaml")])
+	})
+	t.Run("should return an error for a missing directory on execution", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		err := sut.WithDirectory(filepath.Join(dir, "missing"), false).ExecuteApply()
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "could not read directory "+filepath.Join(dir, "missing"))
+	})
+}
@@ -0,0 +1,202 @@
+package apply
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+const helmNotesFile = "NOTES.txt"
+
+// WithHelmChart renders the chart in the root of the given file system, f. i. an embed.FS narrowed with fs.Sub, and
+// adds the rendered manifests. Use WithHelmChartArchive for packaged charts.
+//
+// The chart is rendered locally with the Helm template engine like `helm template`: the given values are merged into
+// the chart's default values and enabled subcharts are rendered, too. No release is stored in the cluster. The CRDs
+// of the chart's crds/ directories are added as well and are applied before all other resources. Hooks are not
+// supported and are skipped. The chart is rendered when the Builder is executed so that the namespace set with
+// WithNamespace is used as release namespace, regardless of the order of the calls.
+//
+// The manifests are added like files named after the release and the template, f. i.
+// "my-release/my-chart/templates/deployment.yaml", at the position at which the chart was added. Errors while
+// rendering the chart are returned by the Execute methods. This method is optional.
+func (ab *Builder) WithHelmChart(fsys fs.FS, values map[string]interface{}, releaseName string) *Builder {
+	helmChart, err := loadHelmChart(fsys)
+	if err != nil {
+		ab.loadErrors = append(ab.loadErrors, fmt.Errorf("could not load helm chart for release %s: %w", releaseName, err))
+		return ab
+	}
+
+	return ab.withHelmChart(helmChart, values, releaseName)
+}
+
+// WithHelmChartArchive renders the given packaged chart (.tgz) like WithHelmChart. This method is optional.
+func (ab *Builder) WithHelmChartArchive(chartArchive []byte, values map[string]interface{}, releaseName string) *Builder {
+	helmChart, err := loader.LoadArchive(bytes.NewReader(chartArchive))
+	if err != nil {
+		ab.loadErrors = append(ab.loadErrors, fmt.Errorf("could not load helm chart for release %s: %w", releaseName, err))
+		return ab
+	}
+
+	return ab.withHelmChart(helmChart, values, releaseName)
+}
+
+func (ab *Builder) withHelmChart(helmChart *chart.Chart, values map[string]interface{}, releaseName string) *Builder {
+	if !ab.hasFile(releaseName) {
+		ab.fileOrder = append(ab.fileOrder, releaseName)
+	}
+	delete(ab.fileToGenericResource, releaseName)
+	ab.fileToHelmRelease[releaseName] = &helmRelease{chart: helmChart, values: values, name: releaseName}
+
+	return ab
+}
+
+// helmRelease contains a chart which is rendered when the Builder is executed.
+type helmRelease struct {
+	chart  *chart.Chart
+	values map[string]interface{}
+	name   string
+}
+
+// render returns the CRDs and rendered manifests of the release, each named after the release and its file.
+func (r *helmRelease) render(namespace string) ([]renderedManifest, error) {
+	var rendered []renderedManifest
+	for _, crd := range r.chart.CRDObjects() {
+		rendered = append(rendered, renderedManifest{name: path.Join(r.name, crd.Filename), content: crd.File.Data})
+	}
+
+	manifests, err := renderHelmChart(r.chart, r.values, r.name, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("could not render helm chart %s for release %s: %w", r.chart.Name(), r.name, err)
+	}
+	for _, manifest := range manifests {
+		rendered = append(rendered, renderedManifest{name: path.Join(r.name, manifest.name), content: manifest.content})
+	}
+
+	return rendered, nil
+}
+
+// renderHelmReleases renders the added charts into the namespace of the Builder and returns the file order and
+// resources with the manifests of each chart in place of its release.
+func (ab *Builder) renderHelmReleases(resources map[string][]byte) ([]string, map[string][]byte, error) {
+	if len(ab.fileToHelmRelease) == 0 {
+		return ab.fileOrder, resources, nil
+	}
+
+	fileOrder := make([]string, 0, len(ab.fileOrder))
+	allResources := make(map[string][]byte, len(resources))
+	for filename, resource := range resources {
+		allResources[filename] = resource
+	}
+
+	for _, filename := range ab.fileOrder {
+		release, ok := ab.fileToHelmRelease[filename]
+		if !ok {
+			fileOrder = append(fileOrder, filename)
+			continue
+		}
+
+		manifests, err := release.render(ab.namespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, manifest := range manifests {
+			fileOrder = append(fileOrder, manifest.name)
+			allResources[manifest.name] = manifest.content
+		}
+	}
+
+	return fileOrder, allResources, nil
+}
+
+func loadHelmChart(fsys fs.FS) (*chart.Chart, error) {
+	var files []*loader.BufferedFile
+	err := fs.WalkDir(fsys, ".", func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		files = append(files, &loader.BufferedFile{Name: file, Data: content})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read file system: %w", err)
+	}
+
+	return loader.LoadFiles(files)
+}
+
+// renderedManifest contains all non-hook documents which were rendered from a single chart template.
+type renderedManifest struct {
+	name    string
+	content []byte
+}
+
+func renderHelmChart(helmChart *chart.Chart, values map[string]interface{}, releaseName, namespace string) ([]renderedManifest, error) {
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+
+	err := chartutil.ProcessDependencies(helmChart, values)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseOptions := chartutil.ReleaseOptions{
+		Name:      releaseName,
+		Namespace: namespace,
+		Revision:  1,
+		IsInstall: true,
+	}
+	renderValues, err := chartutil.ToRenderValues(helmChart, values, releaseOptions, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := engine.Render(helmChart, renderValues)
+	if err != nil {
+		return nil, err
+	}
+	for file := range files {
+		if strings.HasSuffix(file, helmNotesFile) {
+			delete(files, file)
+		}
+	}
+
+	_, manifests, err := releaseutil.SortManifests(files, chartutil.DefaultCapabilities.APIVersions, releaseutil.InstallOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	// SortManifests returns single documents sorted by kind; they are regrouped by template so that the Builder can
+	// order them together with all other documents
+	var rendered []renderedManifest
+	templateIndex := make(map[string]int)
+	for _, manifest := range manifests {
+		i, ok := templateIndex[manifest.Name]
+		if !ok {
+			i = len(rendered)
+			templateIndex[manifest.Name] = i
+			rendered = append(rendered, renderedManifest{name: manifest.Name})
+		}
+
+		if len(rendered[i].content) > 0 {
+			rendered[i].content = append(rendered[i].content, []byte(yamlDocumentSeparator+"\n")...)
+		}
+		rendered[i].content = append(rendered[i].content, []byte(manifest.Content+"\n")...)
+	}
+
+	return rendered, nil
+}
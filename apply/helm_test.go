@@ -0,0 +1,198 @@
+package apply
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func newHelmChartFS() fstest.MapFS {
+	return fstest.MapFS{
+		"Chart.yaml": {Data: []byte(`apiVersion: v2
+name: dogu
+version: 1.0.0
+`)},
+		"values.yaml": {Data: []byte(`replicas: 1
+image: nginx
+`)},
+		"crds/widget.yaml": {Data: []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+`)},
+		"templates/_helpers.tpl": {Data: []byte(`{{- define "dogu.name" -}}{{ .Release.Name }}-{{ .Chart.Name }}{{- end -}}`)},
+		"templates/NOTES.txt":    {Data: []byte(`Installed {{ .Release.Name }}`)},
+		"templates/app.yaml": {Data: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include "dogu.name" . }}
+  namespace: {{ .Release.Namespace }}
+data:
+  image: {{ .Values.image }}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ include "dogu.name" . }}
+`)},
+		"templates/hook.yaml": {Data: []byte(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-install
+`)},
+	}
+}
+
+func TestBuilder_WithHelmChart(t *testing.T) {
+	t.Run("should add the CRDs and rendered manifests without notes and hooks", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{}).WithNamespace("ecosystem")
+
+		// when
+		docs, err := sut.WithHelmChart(newHelmChartFS(), map[string]interface{}{"image": "httpd"}, "web").documents()
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, docs, 3)
+		assert.Equal(t, DocumentReference{Filename: "web/dogu/crds/widget.yaml", Index: 0}, docs[0].DocumentReference)
+		assert.Equal(t, DocumentReference{Filename: "web/dogu/templates/app.yaml", Index: 0}, docs[1].DocumentReference)
+		assert.Equal(t, DocumentReference{Filename: "web/dogu/templates/app.yaml", Index: 1}, docs[2].DocumentReference)
+		assert.Equal(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-dogu
+  namespace: ecosystem
+data:
+  image: httpd
+`, string(docs[1].doc))
+		assert.Equal(t, `apiVersion: v1
+kind: Service
+metadata:
+  name: web-dogu
+`, string(docs[2].doc))
+	})
+	t.Run("should render the chart into the namespace which is set at execution", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{}).
+			WithNamespace("ecosystem").
+			WithHelmChart(newHelmChartFS(), nil, "web").
+			WithNamespace("other")
+
+		// when
+		docs, err := sut.documents()
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, docs, 3)
+		assert.Contains(t, string(docs[1].doc), "namespace: other")
+	})
+	t.Run("should keep the position of the chart between other files", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{}).
+			WithYamlResource("first.yaml", []byte("kind: ConfigMap")).
+			WithHelmChart(newHelmChartFS(), nil, "web").
+			WithYamlResource("last.yaml", []byte("kind: Secret"))
+
+		// when
+		docs, err := sut.documents()
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, docs, 5)
+		assert.Equal(t, "first.yaml", docs[0].Filename)
+		assert.Equal(t, "web/dogu/crds/widget.yaml", docs[1].Filename)
+		assert.Equal(t, "last.yaml", docs[4].Filename)
+	})
+	t.Run("should return render errors on execution", func(t *testing.T) {
+		// given
+		chartFS := newHelmChartFS()
+		chartFS["templates/broken.yaml"] = &fstest.MapFile{Data: []byte(`{{ required "image is required" .Values.missing }}`)}
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		err := sut.WithHelmChart(chartFS, nil, "web").ExecuteApply()
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "could not render helm chart dogu for release web")
+		assert.ErrorContains(t, err, "image is required")
+	})
+	t.Run("should return load errors on execution", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		err := sut.WithHelmChart(fstest.MapFS{"values.yaml": {Data: []byte("a: b")}}, nil, "web").ExecuteApply()
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "could not load helm chart for release web")
+	})
+	t.Run("should not render chart output again as template", func(t *testing.T) {
+		// given
+		chartFS := newHelmChartFS()
+		chartFS["templates/rule.yaml"] = &fstest.MapFile{Data: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: rule
+data:
+  summary: '{{ "{{" }} $labels.instance {{ "}}" }}'
+`)}
+		sut := NewBuilder(&mockApplier{}).
+			WithHelmChart(chartFS, nil, "web").
+			WithYamlResource("other.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}`)).
+			WithTemplate("other.yaml", map[string]string{"Name": "other"})
+
+		// when
+		docs, err := sut.documents()
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, docs, 5)
+		assert.Contains(t, string(docs[3].doc), `summary: '{{ $labels.instance }}'`)
+		assert.Contains(t, string(docs[4].doc), "name: other")
+	})
+}
+
+func TestBuilder_WithHelmChartArchive(t *testing.T) {
+	t.Run("should render a packaged chart", func(t *testing.T) {
+		// given
+		helmChart, err := loadHelmChart(newHelmChartFS())
+		require.NoError(t, err)
+		archivePath, err := chartutil.Save(helmChart, t.TempDir())
+		require.NoError(t, err)
+		archive, err := os.ReadFile(archivePath)
+		require.NoError(t, err)
+
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		docs, err := sut.WithHelmChartArchive(archive, nil, "web").documents()
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, docs, 3)
+		assert.Equal(t, "web/dogu/crds/widget.yaml", docs[0].Filename)
+		assert.Contains(t, string(docs[1].doc), "image: nginx")
+	})
+	t.Run("should return invalid archives on execution", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		err := sut.WithHelmChartArchive([]byte("no archive"), nil, "web").ExecuteApply()
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "could not load helm chart for release web")
+	})
+}
@@ -0,0 +1,192 @@
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const configMapInventoryKey = "inventory"
+
+// InventoryEntry identifies a single resource which was applied to the cluster.
+type InventoryEntry struct {
+	Group     string    `json:"group"`
+	Version   string    `json:"version"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid,omitempty"`
+}
+
+// String returns the string representation of this entry.
+func (e InventoryEntry) String() string {
+	gk := schema.GroupKind{Group: e.Group, Kind: e.Kind}
+	if e.Namespace == "" {
+		return fmt.Sprintf("%s/%s", gk, e.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", gk, e.Namespace, e.Name)
+}
+
+// key identifies the resource independent of its version and UID.
+func (e InventoryEntry) key() string {
+	return fmt.Sprintf("%s/%s/%s/%s", e.Group, e.Kind, e.Namespace, e.Name)
+}
+
+func newInventoryEntry(resource *unstructured.Unstructured) InventoryEntry {
+	gvk := resource.GroupVersionKind()
+	return InventoryEntry{
+		Group:     gvk.Group,
+		Version:   gvk.Version,
+		Kind:      gvk.Kind,
+		Namespace: resource.GetNamespace(),
+		Name:      resource.GetName(),
+		UID:       resource.GetUID(),
+	}
+}
+
+// Inventory records all resources which were applied during a Builder run.
+type Inventory struct {
+	Entries []InventoryEntry `json:"entries"`
+}
+
+// InventoryComparison describes the differences between a stored inventory and the current manifests.
+type InventoryComparison struct {
+	// Added contains resources which are part of the current manifests but not of the inventory.
+	Added []InventoryEntry
+	// Removed contains resources which are part of the inventory but not of the current manifests.
+	Removed []InventoryEntry
+	// Retained contains resources which are part of both. The entries are taken from the inventory.
+	Retained []InventoryEntry
+}
+
+// Compare compares the inventory with the given entries, f. i. the entries of the current manifests. Entries are
+// matched by group, kind, namespace and name.
+func (i *Inventory) Compare(current []InventoryEntry) *InventoryComparison {
+	comparison := &InventoryComparison{}
+
+	currentKeys := make(map[string]bool, len(current))
+	for _, entry := range current {
+		currentKeys[entry.key()] = true
+	}
+
+	storedKeys := make(map[string]bool, len(i.Entries))
+	for _, entry := range i.Entries {
+		storedKeys[entry.key()] = true
+		if currentKeys[entry.key()] {
+			comparison.Retained = append(comparison.Retained, entry)
+		} else {
+			comparison.Removed = append(comparison.Removed, entry)
+		}
+	}
+
+	for _, entry := range current {
+		if !storedKeys[entry.key()] {
+			comparison.Added = append(comparison.Added, entry)
+		}
+	}
+
+	return comparison
+}
+
+// InventoryTarget describes the resource which stores an inventory.
+type InventoryTarget struct {
+	// GroupVersionKind contains the type of the resource, f. i. a ConfigMap or a custom resource.
+	GroupVersionKind schema.GroupVersionKind
+	// Namespace contains the namespace of the resource. It must be empty for cluster-scoped resources.
+	Namespace string
+	// Name contains the name of the resource.
+	Name string
+	// FieldPath points to a string field of the resource which holds the JSON encoded inventory.
+	FieldPath []string
+}
+
+// ConfigMapInventory returns a target that stores the inventory in the data of a ConfigMap with the given namespace
+// and name.
+func ConfigMapInventory(namespace, name string) InventoryTarget {
+	return InventoryTarget{
+		GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+		Namespace:        namespace,
+		Name:             name,
+		FieldPath:        []string{"data", configMapInventoryKey},
+	}
+}
+
+func (t InventoryTarget) String() string {
+	return fmt.Sprintf("%s %s/%s", t.GroupVersionKind.Kind, t.Namespace, t.Name)
+}
+
+// inventoryDocument creates a YAML document which writes the inventory to the target resource when it is applied.
+func inventoryDocument(target InventoryTarget, inventory *Inventory) (YamlDocument, error) {
+	encoded, err := json.Marshal(inventory)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode inventory for %s: %w", target, err)
+	}
+
+	resource := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	resource.SetGroupVersionKind(target.GroupVersionKind)
+	resource.SetName(target.Name)
+	resource.SetNamespace(target.Namespace)
+	err = unstructured.SetNestedField(resource.Object, string(encoded), target.FieldPath...)
+	if err != nil {
+		return nil, fmt.Errorf("could not set inventory field of %s: %w", target, err)
+	}
+
+	doc, err := yaml.Marshal(resource.Object)
+	if err != nil {
+		return nil, fmt.Errorf("could not create inventory document for %s: %w", target, err)
+	}
+
+	return doc, nil
+}
+
+// ReadInventory fetches the inventory from the given target resource. An empty inventory is returned if the target
+// resource does not exist yet.
+func (ac *Applier) ReadInventory(ctx context.Context, target InventoryTarget) (*Inventory, error) {
+	gvk := target.GroupVersionKind
+	mapping, err := ac.restMapping(ctx, gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("could not find GVK mapper for GroupKind=%v,Version=%s while reading inventory: %w", gvk.GroupKind(), gvk.Version, err)
+	}
+
+	resource, err := ac.dynClient.Resource(mapping.Resource).Namespace(target.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return &Inventory{}, nil
+	}
+	if err != nil {
+		return nil, NewResourceError(err, "error while reading inventory", gvk.Kind, gvk.GroupVersion().String(), target.Name)
+	}
+
+	encoded, found, err := unstructured.NestedString(resource.Object, target.FieldPath...)
+	if err != nil {
+		return nil, NewResourceError(err, "error while reading inventory field", gvk.Kind, gvk.GroupVersion().String(), target.Name)
+	}
+	if !found {
+		return &Inventory{}, nil
+	}
+
+	inventory := &Inventory{}
+	err = json.Unmarshal([]byte(encoded), inventory)
+	if err != nil {
+		return nil, NewResourceError(err, "error while decoding inventory", gvk.Kind, gvk.GroupVersion().String(), target.Name)
+	}
+
+	return inventory, nil
+}
+
+// ResolveInventoryEntry decodes the YAML resource and returns the entry it would receive in an inventory after being
+// applied with the given options. The namespace is only set for namespaced resources. The UID stays empty.
+func (ac *Applier) ResolveInventoryEntry(ctx context.Context, yamlResource YamlDocument, namespace string, opts ApplyOptions) (InventoryEntry, error) {
+	resource, _, _, err := ac.prepareResource(ctx, yamlResource, namespace, opts)
+	if err != nil {
+		return InventoryEntry{}, err
+	}
+
+	return newInventoryEntry(resource), nil
+}
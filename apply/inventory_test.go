@@ -0,0 +1,162 @@
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const testInventoryName = "le-inventory"
+
+var (
+	testServiceAccountEntry = InventoryEntry{Version: "v1", Kind: "ServiceAccount", Namespace: testNamespace, Name: "le-service-account", UID: "1"}
+	testNamespaceEntry      = InventoryEntry{Version: "v1", Kind: "Namespace", Name: "le-namespace", UID: "2"}
+	testDeploymentEntry     = InventoryEntry{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: testNamespace, Name: "le-deployment"}
+)
+
+func TestInventory_Compare(t *testing.T) {
+	t.Run("should find added, removed and retained resources", func(t *testing.T) {
+		// given
+		sut := &Inventory{Entries: []InventoryEntry{testServiceAccountEntry, testNamespaceEntry}}
+		currentServiceAccount := testServiceAccountEntry
+		currentServiceAccount.UID = ""
+
+		// when
+		actual := sut.Compare([]InventoryEntry{currentServiceAccount, testDeploymentEntry})
+
+		// then
+		assert.Equal(t, []InventoryEntry{testDeploymentEntry}, actual.Added)
+		assert.Equal(t, []InventoryEntry{testNamespaceEntry}, actual.Removed)
+		assert.Equal(t, []InventoryEntry{testServiceAccountEntry}, actual.Retained)
+	})
+}
+
+func TestInventoryEntry_String(t *testing.T) {
+	assert.Equal(t, "ServiceAccount/le-namespace/le-service-account", testServiceAccountEntry.String())
+	assert.Equal(t, "Namespace/le-namespace", testNamespaceEntry.String())
+	assert.Equal(t, "Deployment.apps/le-namespace/le-deployment", testDeploymentEntry.String())
+}
+
+func Test_inventoryDocument(t *testing.T) {
+	t.Run("should write the inventory as JSON into a ConfigMap", func(t *testing.T) {
+		// given
+		inventory := &Inventory{Entries: []InventoryEntry{testNamespaceEntry}}
+
+		// when
+		actual, err := inventoryDocument(ConfigMapInventory(testNamespace, testInventoryName), inventory)
+
+		// then
+		require.NoError(t, err)
+		expected := `apiVersion: v1
+data:
+  inventory: '{"entries":[{"group":"","version":"v1","kind":"Namespace","name":"le-namespace","uid":"2"}]}'
+kind: ConfigMap
+metadata:
+  name: le-inventory
+  namespace: le-namespace
+`
+		assert.Equal(t, expected, string(actual))
+	})
+}
+
+func newStoredInventory(encoded string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"data": map[string]interface{}{"inventory": encoded},
+	}}
+}
+
+func TestApplier_ReadInventory(t *testing.T) {
+	target := ConfigMapInventory(testNamespace, testInventoryName)
+
+	t.Run("should decode the stored inventory", func(t *testing.T) {
+		// given
+		stored := newStoredInventory(`{"entries":[{"group":"","version":"v1","kind":"Namespace","name":"le-namespace","uid":"2"}]}`)
+		sut, apiInterfaceMock := newMappedApplier(t, testConfigMapMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, testInventoryName, metav1.GetOptions{}).Return(stored, nil)
+
+		// when
+		actual, err := sut.ReadInventory(context.Background(), target)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, &Inventory{Entries: []InventoryEntry{testNamespaceEntry}}, actual)
+	})
+	t.Run("should return an empty inventory if the target does not exist", func(t *testing.T) {
+		// given
+		notFound := k8serrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, testInventoryName)
+		sut, apiInterfaceMock := newMappedApplier(t, testConfigMapMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, testInventoryName, metav1.GetOptions{}).Return(nil, notFound)
+
+		// when
+		actual, err := sut.ReadInventory(context.Background(), target)
+
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, actual.Entries)
+	})
+	t.Run("should fail to fetch the target", func(t *testing.T) {
+		// given
+		sut, apiInterfaceMock := newMappedApplier(t, testConfigMapMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, testInventoryName, metav1.GetOptions{}).Return(nil, assert.AnError)
+
+		// when
+		_, err := sut.ReadInventory(context.Background(), target)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "error while reading inventory")
+	})
+	t.Run("should fail to decode the inventory", func(t *testing.T) {
+		// given
+		sut, apiInterfaceMock := newMappedApplier(t, testConfigMapMapping, testNamespace)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, testInventoryName, metav1.GetOptions{}).Return(newStoredInventory("{"), nil)
+
+		// when
+		_, err := sut.ReadInventory(context.Background(), target)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "error while decoding inventory")
+	})
+}
+
+func TestApplier_ResolveInventoryEntry(t *testing.T) {
+	t.Run("should resolve the namespace of a namespaced resource", func(t *testing.T) {
+		// given
+		serviceAccountMapping := &meta.RESTMapping{
+			Resource:         schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"},
+			GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"},
+			Scope:            meta.RESTScopeNamespace,
+		}
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().RESTMapping(schema.GroupKind{Kind: "ServiceAccount"}, "v1").Return(serviceAccountMapping, nil)
+		apiInterfaceMock := newMockNamespaceInterface(t)
+		apiInterfaceMock.EXPECT().Namespace(testNamespace).Return(apiInterfaceMock)
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(serviceAccountMapping.Resource).Return(apiInterfaceMock)
+
+		sut := &Applier{gvrMapper: gvrMapperMock, dynClient: dynClientMock}
+		doc := YamlDocument(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: le-service-account`)
+
+		// when
+		actual, err := sut.ResolveInventoryEntry(context.Background(), doc, testNamespace, ApplyOptions{})
+
+		// then
+		require.NoError(t, err)
+		expected := testServiceAccountEntry
+		expected.UID = ""
+		assert.Equal(t, expected, actual)
+	})
+}
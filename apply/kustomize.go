@@ -0,0 +1,65 @@
+package apply
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// WithKustomization builds the kustomization in the given directory of the file system in-process and adds the
+// resulting documents like a file named after the directory. The file system may be an embed.FS or an fstest.MapFS
+// and must contain all bases and overlays the kustomization refers to. Remote bases are not supported. Errors while
+// building the kustomization are returned by the Execute methods. This method is optional.
+func (ab *Builder) WithKustomization(fsys fs.FS, dir string) *Builder {
+	rendered, err := buildKustomization(fsys, dir)
+	if err != nil {
+		ab.loadErrors = append(ab.loadErrors, fmt.Errorf("could not build kustomization %s: %w", dir, err))
+		return ab
+	}
+
+	return ab.withRenderedResource(dir, rendered)
+}
+
+func buildKustomization(fsys fs.FS, dir string) ([]byte, error) {
+	memFS, err := copyToMemoryFS(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resources, err := kustomizer.Run(memFS, path.Join("/", dir))
+	if err != nil {
+		return nil, err
+	}
+
+	return resources.AsYaml()
+}
+
+// copyToMemoryFS copies all files into an in-memory file system because kustomize does not work on fs.FS.
+func copyToMemoryFS(fsys fs.FS) (filesys.FileSystem, error) {
+	memFS := filesys.MakeFsInMemory()
+	err := fs.WalkDir(fsys, ".", func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := path.Join("/", file)
+		if entry.IsDir() {
+			return memFS.MkdirAll(target)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		return memFS.WriteFile(target, content)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read file system: %w", err)
+	}
+
+	return memFS, nil
+}
@@ -0,0 +1,97 @@
+package apply
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKustomizationFS() fstest.MapFS {
+	return fstest.MapFS{
+		"base/kustomization.yaml": {Data: []byte(`resources:
+- configmap.yaml
+`)},
+		"base/configmap.yaml": {Data: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  level: info
+`)},
+		"overlays/dev/kustomization.yaml": {Data: []byte(`resources:
+- ../../base
+namePrefix: dev-
+patches:
+- path: level.yaml
+`)},
+		"overlays/dev/level.yaml": {Data: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  level: debug
+`)},
+	}
+}
+
+func TestBuilder_WithKustomization(t *testing.T) {
+	t.Run("should add the built overlay", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		sut.WithKustomization(newKustomizationFS(), "overlays/dev")
+
+		// then
+		require.Empty(t, sut.loadErrors)
+		assert.Equal(t, []string{"overlays/dev"}, sut.fileOrder)
+		expected := `apiVersion: v1
+data:
+  level: debug
+kind: ConfigMap
+metadata:
+  name: dev-settings
+`
+		assert.Equal(t, expected, string(sut.fileToGenericResource["overlays/dev"]))
+	})
+	t.Run("should return build errors on execution", func(t *testing.T) {
+		// given
+		sut := NewBuilder(&mockApplier{})
+
+		// when
+		err := sut.WithKustomization(newKustomizationFS(), "overlays/prod").ExecuteApply()
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "could not load manifests: could not build kustomization overlays/prod")
+	})
+	t.Run("should not render the built overlay again as template", func(t *testing.T) {
+		// given
+		kustomizationFS := newKustomizationFS()
+		kustomizationFS["base/configmap.yaml"] = &fstest.MapFile{Data: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  summary: '{{ $labels.instance }}'
+`)}
+		sut := NewBuilder(&mockApplier{}).
+			WithKustomization(kustomizationFS, "base").
+			WithYamlResource("other.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}`)).
+			WithTemplate("other.yaml", map[string]string{"Name": "other"})
+
+		// when
+		docs, err := sut.documents()
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+		assert.Contains(t, string(docs[0].doc), `summary: '{{ $labels.instance }}'`)
+		assert.Contains(t, string(docs[1].doc), "name: other")
+	})
+}
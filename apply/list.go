@@ -0,0 +1,89 @@
+package apply
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// expandDocument splits documents which contain several resources into single resource documents. These are JSON
+// arrays, f. i. produced by jq, v1.List and the lists of built-in kinds like v1.ConfigMapList, f. i. produced by
+// kubectl get -o json. The returned bool is false for documents which contain a single resource.
+func expandDocument(doc YamlDocument) ([]YamlDocument, bool, error) {
+	trimmed := bytes.TrimSpace(doc)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []interface{}
+		err := json.Unmarshal(trimmed, &items)
+		if err != nil {
+			return nil, false, fmt.Errorf("could not decode JSON array: %w", err)
+		}
+
+		expanded, err := marshalItems(items)
+		return expanded, true, err
+	}
+
+	var list struct {
+		APIVersion string        `json:"apiVersion"`
+		Kind       string        `json:"kind"`
+		Items      []interface{} `json:"items"`
+	}
+	err := yaml.Unmarshal(doc, &list)
+	if err != nil || !isListKind(schema.FromAPIVersionAndKind(list.APIVersion, list.Kind)) || list.Items == nil {
+		// documents which cannot be parsed are not lists; the applier reports them in the context of the document
+		return nil, false, nil
+	}
+
+	expanded, err := marshalItems(list.Items)
+	return expanded, true, err
+}
+
+// isListKind returns true for v1 List and the list types of the built-in kinds like v1 ConfigMapList. Custom
+// resources whose kind ends with "List" are regular resources.
+func isListKind(gvk schema.GroupVersionKind) bool {
+	if gvk == (schema.GroupVersionKind{Version: "v1", Kind: "List"}) {
+		return true
+	}
+
+	return strings.HasSuffix(gvk.Kind, "List") && clientgoscheme.Scheme.Recognizes(gvk)
+}
+
+func marshalItems(items []interface{}) ([]YamlDocument, error) {
+	docs := make([]YamlDocument, 0, len(items))
+	for i, item := range items {
+		doc, err := yaml.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode item %d: %w", i+1, err)
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+// expandDocuments replaces all List and JSON array documents with their items.
+func expandDocuments(docs []sourceDocument) ([]sourceDocument, error) {
+	expandedDocs := make([]sourceDocument, 0, len(docs))
+	for _, doc := range docs {
+		items, isList, err := expandDocument(doc.doc)
+		if err != nil {
+			return nil, fmt.Errorf("could not expand list document %s: %w", doc.DocumentReference, err)
+		}
+		if !isList {
+			expandedDocs = append(expandedDocs, doc)
+			continue
+		}
+
+		for i, item := range items {
+			ref := doc.DocumentReference
+			ref.Item = i + 1
+			expandedDocs = append(expandedDocs, sourceDocument{DocumentReference: ref, doc: item})
+		}
+	}
+
+	return expandedDocs, nil
+}
@@ -0,0 +1,138 @@
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_expandDocument(t *testing.T) {
+	tests := []struct {
+		name       string
+		doc        string
+		wantIsList bool
+		wantItems  []string
+	}{
+		{
+			name:       "single resource",
+			doc:        "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n",
+			wantIsList: false,
+		},
+		{
+			name:       "v1 List",
+			doc:        "apiVersion: v1\nkind: List\nitems:\n- apiVersion: v1\n  kind: ConfigMap\n  metadata:\n    name: a\n- apiVersion: v1\n  kind: Secret\n  metadata:\n    name: b\n",
+			wantIsList: true,
+			wantItems: []string{
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n",
+				"apiVersion: v1\nkind: Secret\nmetadata:\n  name: b\n",
+			},
+		},
+		{
+			name:       "typed list from kubectl get -o json",
+			doc:        `{"apiVersion": "v1", "kind": "ConfigMapList", "items": [{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a"}}]}`,
+			wantIsList: true,
+			wantItems:  []string{"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n"},
+		},
+		{
+			name:       "empty list",
+			doc:        "apiVersion: v1\nkind: List\nitems: []\n",
+			wantIsList: true,
+			wantItems:  []string{},
+		},
+		{
+			name:       "JSON array",
+			doc:        "\n[{\"apiVersion\": \"v1\", \"kind\": \"ConfigMap\", \"metadata\": {\"name\": \"a\"}}, {\"apiVersion\": \"v1\", \"kind\": \"Secret\", \"metadata\": {\"name\": \"b\"}}]\n",
+			wantIsList: true,
+			wantItems: []string{
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n",
+				"apiVersion: v1\nkind: Secret\nmetadata:\n  name: b\n",
+			},
+		},
+		{
+			name:       "single JSON resource",
+			doc:        `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a"}}`,
+			wantIsList: false,
+		},
+		{
+			name:       "typed list of another API group",
+			doc:        "apiVersion: apps/v1\nkind: DeploymentList\nitems:\n- apiVersion: apps/v1\n  kind: Deployment\n  metadata:\n    name: a\n",
+			wantIsList: true,
+			wantItems:  []string{"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: a\n"},
+		},
+		{
+			name:       "custom resource with kind ending with List and items",
+			doc:        "apiVersion: example.com/v1\nkind: AllowList\nitems:\n- host: example.com\n",
+			wantIsList: false,
+		},
+		{
+			name:       "List of another API version",
+			doc:        "apiVersion: example.com/v1\nkind: List\nitems:\n- host: example.com\n",
+			wantIsList: false,
+		},
+		{
+			name:       "kind ending with List without items",
+			doc:        "apiVersion: example.com/v1\nkind: AllowList\nspec:\n  hosts: []\n",
+			wantIsList: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			items, isList, err := expandDocument([]byte(tt.doc))
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantIsList, isList)
+			actual := make([]string, 0, len(items))
+			for _, item := range items {
+				actual = append(actual, string(item))
+			}
+			if tt.wantIsList {
+				assert.Equal(t, tt.wantItems, actual)
+			}
+		})
+	}
+
+	t.Run("should fail for an invalid JSON array", func(t *testing.T) {
+		// when
+		_, _, err := expandDocument([]byte(`[{"kind": "ConfigMap"`))
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "could not decode JSON array")
+	})
+}
+
+func Test_expandDocuments(t *testing.T) {
+	t.Run("should reference the items of a list", func(t *testing.T) {
+		// given
+		docs := []sourceDocument{
+			{DocumentReference: DocumentReference{Filename: "a.yaml", Index: 0}, doc: []byte("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: ns\n")},
+			{DocumentReference: DocumentReference{Filename: "a.yaml", Index: 1}, doc: []byte("apiVersion: v1\nkind: List\nitems:\n- kind: ConfigMap\n- kind: Secret\n")},
+		}
+
+		// when
+		actual, err := expandDocuments(docs)
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, actual, 3)
+		assert.Equal(t, "a.yaml[0]", actual[0].String())
+		assert.Equal(t, "a.yaml[1] item 1", actual[1].String())
+		assert.Equal(t, "kind: ConfigMap\n", string(actual[1].doc))
+		assert.Equal(t, "a.yaml[1] item 2", actual[2].String())
+		assert.Equal(t, "kind: Secret\n", string(actual[2].doc))
+	})
+	t.Run("should fail with the document reference", func(t *testing.T) {
+		// given
+		docs := []sourceDocument{{DocumentReference: DocumentReference{Filename: "b.json", Index: 0}, doc: []byte("[1, ")}}
+
+		// when
+		_, err := expandDocuments(docs)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "could not expand list document b.json[0]")
+	})
+}
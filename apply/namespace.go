@@ -0,0 +1,68 @@
+package apply
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// NamespacePolicy decides how the namespace passed to the Applier or set with Builder.WithNamespace is combined with
+// the namespace declared in the metadata of namespaced resources. Cluster-scoped resources are never affected.
+type NamespacePolicy string
+
+const (
+	// NamespacePolicyEnforce always uses the given namespace and overrides namespaces declared in documents. This is
+	// the default.
+	NamespacePolicyEnforce NamespacePolicy = "Enforce"
+	// NamespacePolicyDefault keeps namespaces declared in documents and uses the given namespace only for documents
+	// without a namespace. This allows applying bundles which span several namespaces in one run.
+	NamespacePolicyDefault NamespacePolicy = "Default"
+	// NamespacePolicyRejectMismatch uses the given namespace but fails for documents which declare another namespace.
+	NamespacePolicyRejectMismatch NamespacePolicy = "RejectMismatch"
+)
+
+// ErrNamespaceMismatch is returned with NamespacePolicyRejectMismatch for documents which declare a namespace other
+// than the given one.
+var ErrNamespaceMismatch = errors.New("namespace mismatch")
+
+// WithNamespacePolicy sets the NamespacePolicy which is used if ApplyOptions or DeleteOptions do not set one. It
+// defaults to NamespacePolicyEnforce.
+func (ac *Applier) WithNamespacePolicy(policy NamespacePolicy) *Applier {
+	ac.namespacePolicy = policy
+
+	return ac
+}
+
+func (ac *Applier) effectiveNamespacePolicy(policy NamespacePolicy) NamespacePolicy {
+	if policy != "" {
+		return policy
+	}
+
+	return ac.namespacePolicy
+}
+
+// resolveNamespace returns the namespace which the namespaced resource is applied to.
+func resolveNamespace(resource *unstructured.Unstructured, namespace string, policy NamespacePolicy) (string, error) {
+	declared := resource.GetNamespace()
+
+	switch policy {
+	case "", NamespacePolicyEnforce:
+		return namespace, nil
+	case NamespacePolicyDefault:
+		if declared != "" {
+			return declared, nil
+		}
+		if namespace == "" {
+			return "", fmt.Errorf("resource %s %s declares no namespace and no default namespace is given", resource.GetKind(), resource.GetName())
+		}
+		return namespace, nil
+	case NamespacePolicyRejectMismatch:
+		if declared != "" && declared != namespace {
+			return "", fmt.Errorf("%w: resource %s %s declares namespace %s but namespace %s is required", ErrNamespaceMismatch, resource.GetKind(), resource.GetName(), declared, namespace)
+		}
+		return namespace, nil
+	default:
+		return "", fmt.Errorf("unknown namespace policy %s", policy)
+	}
+}
@@ -0,0 +1,198 @@
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func Test_resolveNamespace(t *testing.T) {
+	tests := []struct {
+		name          string
+		declared      string
+		given         string
+		policy        NamespacePolicy
+		wantNamespace string
+		wantErr       string
+	}{
+		{name: "enforce by default", declared: "other", given: "ecosystem", wantNamespace: "ecosystem"},
+		{name: "enforce", declared: "other", given: "ecosystem", policy: NamespacePolicyEnforce, wantNamespace: "ecosystem"},
+		{name: "default keeps declared namespace", declared: "other", given: "ecosystem", policy: NamespacePolicyDefault, wantNamespace: "other"},
+		{name: "default fills in empty namespace", given: "ecosystem", policy: NamespacePolicyDefault, wantNamespace: "ecosystem"},
+		{name: "default without any namespace", policy: NamespacePolicyDefault, wantErr: "resource ConfigMap config declares no namespace and no default namespace is given"},
+		{name: "reject mismatch accepts equal namespace", declared: "ecosystem", given: "ecosystem", policy: NamespacePolicyRejectMismatch, wantNamespace: "ecosystem"},
+		{name: "reject mismatch fills in empty namespace", given: "ecosystem", policy: NamespacePolicyRejectMismatch, wantNamespace: "ecosystem"},
+		{name: "reject mismatch", declared: "other", given: "ecosystem", policy: NamespacePolicyRejectMismatch, wantErr: "namespace mismatch: resource ConfigMap config declares namespace other but namespace ecosystem is required"},
+		{name: "unknown policy", given: "ecosystem", policy: "Sometimes", wantErr: "unknown namespace policy Sometimes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			resource := &unstructured.Unstructured{}
+			resource.SetKind("ConfigMap")
+			resource.SetName("config")
+			resource.SetNamespace(tt.declared)
+
+			// when
+			actual, err := resolveNamespace(resource, tt.given, tt.policy)
+
+			// then
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantNamespace, actual)
+		})
+	}
+
+	t.Run("should be identifiable as mismatch", func(t *testing.T) {
+		// given
+		resource := &unstructured.Unstructured{}
+		resource.SetNamespace("other")
+
+		// when
+		_, err := resolveNamespace(resource, "ecosystem", NamespacePolicyRejectMismatch)
+
+		// then
+		assert.ErrorIs(t, err, ErrNamespaceMismatch)
+	})
+}
+
+func TestApplier_WithNamespacePolicy(t *testing.T) {
+	newApplier := func(t *testing.T, expectedNamespace string) *Applier {
+		mockedRestMapping := &meta.RESTMapping{
+			Resource:         schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+			GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			Scope:            meta.RESTScopeNamespace,
+		}
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().RESTMapping(schema.GroupKind{Kind: "ConfigMap"}, "v1").Return(mockedRestMapping, nil)
+
+		apiInterfaceMock := newMockNamespaceInterface(t)
+		apiInterfaceMock.EXPECT().Namespace(expectedNamespace).Return(apiInterfaceMock)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "config", metav1.GetOptions{}).
+			Return(nil, k8serrors.NewNotFound(schema.GroupResource{}, "config"))
+		apiInterfaceMock.EXPECT().Patch(mock.Anything, "config", mock.Anything, mock.Anything, mock.Anything).
+			RunAndReturn(func(_ context.Context, _ string, _ types.PatchType, data []byte, _ metav1.PatchOptions, _ ...string) (*unstructured.Unstructured, error) {
+				applied := &unstructured.Unstructured{}
+				err := applied.UnmarshalJSON(data)
+				return applied, err
+			})
+
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(mock.Anything).Return(apiInterfaceMock)
+
+		return &Applier{gvrMapper: gvrMapperMock, dynClient: dynClientMock}
+	}
+	testResource := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: other`)
+
+	t.Run("should override the declared namespace by default", func(t *testing.T) {
+		// given
+		sut := newApplier(t, "ecosystem")
+
+		// when
+		actual, err := sut.ApplyWithOptions(context.Background(), testResource, "ecosystem", ApplyOptions{})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "ecosystem", actual.Object.GetNamespace())
+	})
+	t.Run("should keep the declared namespace with the policy of the applier", func(t *testing.T) {
+		// given
+		sut := newApplier(t, "other").WithNamespacePolicy(NamespacePolicyDefault)
+
+		// when
+		actual, err := sut.ApplyWithOptions(context.Background(), testResource, "ecosystem", ApplyOptions{})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "other", actual.Object.GetNamespace())
+	})
+	t.Run("should prefer the policy of the options", func(t *testing.T) {
+		// given
+		sut := newApplier(t, "ecosystem").WithNamespacePolicy(NamespacePolicyDefault)
+
+		// when
+		actual, err := sut.ApplyWithOptions(context.Background(), testResource, "ecosystem", ApplyOptions{NamespacePolicy: NamespacePolicyEnforce})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "ecosystem", actual.Object.GetNamespace())
+	})
+	t.Run("should reject a mismatching namespace before sending the resource", func(t *testing.T) {
+		// given
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().RESTMapping(schema.GroupKind{Kind: "ConfigMap"}, "v1").Return(&meta.RESTMapping{Scope: meta.RESTScopeNamespace}, nil)
+		sut := &Applier{gvrMapper: gvrMapperMock, dynClient: newMockDynClient(t)}
+
+		// when
+		_, err := sut.ApplyWithOptions(context.Background(), testResource, "ecosystem", ApplyOptions{NamespacePolicy: NamespacePolicyRejectMismatch})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrNamespaceMismatch)
+	})
+}
+
+func TestBuilder_WithNamespacePolicy(t *testing.T) {
+	t.Run("should pass the policy to the applier", func(t *testing.T) {
+		// given
+		doc := YamlDocument("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n  namespace: other\n")
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", mock.Anything, doc, "ecosystem", ApplyOptions{NamespacePolicy: NamespacePolicyDefault}).
+			Return(&ResourceResult{}, nil)
+
+		sut := NewBuilder(mockedApplier).
+			WithNamespace("ecosystem").
+			WithNamespacePolicy(NamespacePolicyDefault).
+			WithYamlResource("config.yaml", doc)
+
+		// when
+		err := sut.ExecuteApply()
+
+		// then
+		require.NoError(t, err)
+		mockedApplier.AssertExpectations(t)
+	})
+	t.Run("should render a bundle spanning several namespaces", func(t *testing.T) {
+		// given
+		sut := NewBuilder(nil).
+			WithNamespace("ecosystem").
+			WithNamespacePolicy(NamespacePolicyDefault).
+			WithYamlResource("bundle.yaml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: local
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: monitoring
+  namespace: monitoring
+`))
+
+		// when
+		actual, err := sut.RenderDocuments()
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, actual, 2)
+		assert.Equal(t, "ecosystem", actual[0].Object.GetNamespace())
+		assert.Equal(t, "monitoring", actual[1].Object.GetNamespace())
+	})
+}
@@ -0,0 +1,167 @@
+package apply
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// Option configures an Applier which is created by NewWithOptions.
+type Option func(*applierOptions)
+
+type applierOptions struct {
+	dynClient      dynamic.Interface
+	restMapper     meta.RESTMapper
+	scheme         *runtime.Scheme
+	logger         Logger
+	qps            float32
+	burst          int
+	userAgent      string
+	forceConflicts bool
+}
+
+// WithDynamicClient makes the Applier use the given client instead of creating one from the cluster config, f. i. a
+// dynamic client which is shared with other parts of an operator.
+func WithDynamicClient(client dynamic.Interface) Option {
+	return func(opts *applierOptions) {
+		opts.dynClient = client
+	}
+}
+
+// WithRESTMapper makes the Applier use the given REST mapper instead of creating a discovery-based one, f. i. the
+// cached REST mapper of a controller-runtime manager (mgr.GetRESTMapper()). CRDs which were applied before are only
+// picked up again if the mapper implements meta.ResettableRESTMapper or refreshes itself.
+func WithRESTMapper(mapper meta.RESTMapper) Option {
+	return func(opts *applierOptions) {
+		opts.restMapper = mapper
+	}
+}
+
+// WithScheme makes the Applier use the given scheme to determine the kind of owners, f. i. the scheme of a
+// controller-runtime manager (mgr.GetScheme()).
+func WithScheme(scheme *runtime.Scheme) Option {
+	return func(opts *applierOptions) {
+		opts.scheme = scheme
+	}
+}
+
+// WithLogger makes the Applier log with the given logger instead of the logger returned by GetLogger.
+func WithLogger(logger Logger) Option {
+	return func(opts *applierOptions) {
+		opts.logger = logger
+	}
+}
+
+// WithQPS limits the requests of the clients which the Applier creates to qps queries per second with bursts of up
+// to burst queries. Clients passed with WithDynamicClient or WithRESTMapper are not affected.
+func WithQPS(qps float32, burst int) Option {
+	return func(opts *applierOptions) {
+		opts.qps = qps
+		opts.burst = burst
+	}
+}
+
+// WithUserAgent sets the user agent of the clients which the Applier creates. Clients passed with WithDynamicClient
+// or WithRESTMapper are not affected.
+func WithUserAgent(userAgent string) Option {
+	return func(opts *applierOptions) {
+		opts.userAgent = userAgent
+	}
+}
+
+// WithForceConflicts makes server-side apply take over fields which are managed by other field managers instead of
+// failing with a conflict. See also: https://kubernetes.io/docs/reference/using-api/server-side-apply/#conflicts
+func WithForceConflicts() Option {
+	return func(opts *applierOptions) {
+		opts.forceConflicts = true
+	}
+}
+
+// NewWithOptions works like New but allows to configure the Applier, f. i. to reuse the clients and caches of a
+// controller-runtime manager:
+//
+//	applier, err := apply.NewWithOptions(mgr.GetConfig(), "your-field-manager-name",
+//	  apply.WithRESTMapper(mgr.GetRESTMapper()),
+//	  apply.WithScheme(mgr.GetScheme()),
+//	)
+//
+// The cluster config may be nil if both a dynamic client and a REST mapper are passed. Without WithScheme, an empty
+// scheme is used.
+func NewWithOptions(clusterConfig *rest.Config, fieldManager string, options ...Option) (*Applier, error) {
+	if strings.TrimSpace(fieldManager) == "" {
+		return nil, errors.New("cannot create new Applier: fieldManager must not be empty")
+	}
+
+	opts := &applierOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	if clusterConfig == nil && (opts.restMapper == nil || opts.dynClient == nil) {
+		return nil, errors.New("cannot create new Applier: clusterConfig must not be nil unless a dynamic client and a REST mapper are given")
+	}
+	if clusterConfig != nil {
+		clusterConfig = opts.configure(clusterConfig)
+	}
+
+	gvrMapper := opts.restMapper
+	if gvrMapper == nil {
+		var err error
+		gvrMapper, err = createGVRMapper(clusterConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error while creating GVR mapper: %w", err)
+		}
+	}
+
+	dynCli := opts.dynClient
+	if dynCli == nil {
+		var err error
+		dynCli, err = createDynamicClient(clusterConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error while creating dynamic client: %w", err)
+		}
+	}
+
+	scheme := opts.scheme
+	if scheme == nil {
+		scheme = runtime.NewScheme()
+	}
+
+	return &Applier{
+		gvrMapper:      gvrMapper,
+		dynClient:      dynCli,
+		scheme:         scheme,
+		fieldManager:   fieldManager,
+		logger:         opts.logger,
+		forceConflicts: opts.forceConflicts,
+	}, nil
+}
+
+// configure returns a copy of the cluster config with rate limits and user agent applied so that the caller's config
+// stays untouched.
+func (opts *applierOptions) configure(clusterConfig *rest.Config) *rest.Config {
+	configured := rest.CopyConfig(clusterConfig)
+	if opts.qps > 0 {
+		configured.QPS = opts.qps
+		configured.Burst = opts.burst
+	}
+	if opts.userAgent != "" {
+		configured.UserAgent = opts.userAgent
+	}
+
+	return configured
+}
+
+// log returns the logger of the Applier or the logger returned by GetLogger.
+func (ac *Applier) log() Logger {
+	if ac.logger != nil {
+		return ac.logger
+	}
+
+	return GetLogger()
+}
@@ -0,0 +1,198 @@
+package apply
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/pointer"
+)
+
+var testServiceAccount = []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: my-service-account`)
+
+func TestNewWithOptions(t *testing.T) {
+	t.Run("should use injected clients without cluster config", func(t *testing.T) {
+		// given
+		gvrMapperMock := newMockGvrMapper(t)
+		dynClientMock := newMockDynClient(t)
+		scheme := runtime.NewScheme()
+
+		// when
+		actual, err := NewWithOptions(nil, testFieldManagerName,
+			WithRESTMapper(gvrMapperMock),
+			WithDynamicClient(dynClientMock),
+			WithScheme(scheme),
+		)
+
+		// then
+		require.NoError(t, err)
+		assert.Same(t, gvrMapperMock, actual.gvrMapper)
+		assert.Same(t, dynClientMock, actual.dynClient)
+		assert.Same(t, scheme, actual.scheme)
+		assert.Equal(t, testFieldManagerName, actual.fieldManager)
+	})
+	t.Run("should create clients and an empty scheme by default", func(t *testing.T) {
+		// when
+		actual, err := NewWithOptions(&rest.Config{}, testFieldManagerName)
+
+		// then
+		require.NoError(t, err)
+		assert.NotNil(t, actual.gvrMapper)
+		assert.NotNil(t, actual.dynClient)
+		assert.NotNil(t, actual.scheme)
+		assert.Nil(t, actual.logger)
+		assert.False(t, actual.forceConflicts)
+	})
+	t.Run("should apply QPS and user agent without changing the given config", func(t *testing.T) {
+		// given
+		clusterConfig := &rest.Config{UserAgent: "original"}
+
+		// when
+		actual, err := NewWithOptions(clusterConfig, testFieldManagerName,
+			WithQPS(50, 100),
+			WithUserAgent("my-operator"),
+		)
+
+		// then
+		require.NoError(t, err)
+		assert.NotNil(t, actual)
+		assert.Equal(t, &rest.Config{UserAgent: "original"}, clusterConfig)
+	})
+	t.Run("should set logger and force conflicts", func(t *testing.T) {
+		// given
+		logger := logrus.New()
+
+		// when
+		actual, err := NewWithOptions(&rest.Config{}, testFieldManagerName, WithLogger(logger), WithForceConflicts())
+
+		// then
+		require.NoError(t, err)
+		assert.Same(t, logger, actual.logger)
+		assert.True(t, actual.forceConflicts)
+	})
+	t.Run("should fail without cluster config if a client is missing", func(t *testing.T) {
+		// when
+		_, err := NewWithOptions(nil, testFieldManagerName, WithRESTMapper(newMockGvrMapper(t)))
+
+		// then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "clusterConfig must not be nil unless a dynamic client and a REST mapper are given")
+	})
+	t.Run("should fail for empty field manager name", func(t *testing.T) {
+		// when
+		_, err := NewWithOptions(&rest.Config{}, " ")
+
+		// then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "fieldManager must not be empty")
+	})
+}
+
+func Test_applierOptions_configure(t *testing.T) {
+	t.Run("should set rate limits and user agent on a copy", func(t *testing.T) {
+		// given
+		clusterConfig := &rest.Config{Host: "https://example.com", QPS: 5, Burst: 10}
+		opts := &applierOptions{qps: 50, burst: 100, userAgent: "my-operator"}
+
+		// when
+		actual := opts.configure(clusterConfig)
+
+		// then
+		assert.Equal(t, "https://example.com", actual.Host)
+		assert.Equal(t, float32(50), actual.QPS)
+		assert.Equal(t, 100, actual.Burst)
+		assert.Equal(t, "my-operator", actual.UserAgent)
+		assert.Equal(t, float32(5), clusterConfig.QPS)
+		assert.Equal(t, 10, clusterConfig.Burst)
+		assert.Empty(t, clusterConfig.UserAgent)
+	})
+	t.Run("should keep the config values without options", func(t *testing.T) {
+		// given
+		clusterConfig := &rest.Config{QPS: 5, Burst: 10, UserAgent: "original"}
+
+		// when
+		actual := (&applierOptions{}).configure(clusterConfig)
+
+		// then
+		assert.Equal(t, clusterConfig, actual)
+		assert.NotSame(t, clusterConfig, actual)
+	})
+}
+
+func Test_Applier_forceConflicts(t *testing.T) {
+	tests := []struct {
+		name           string
+		forceConflicts bool
+		expectedForce  *bool
+	}{
+		{name: "should force conflicts", forceConflicts: true, expectedForce: pointer.Bool(true)},
+		{name: "should not force conflicts by default", forceConflicts: false, expectedForce: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			sut, apiInterfaceMock := newMappedApplier(t, testServiceAccountMapping, "my-namespace")
+			apiInterfaceMock.EXPECT().Get(mock.Anything, "my-service-account", metav1.GetOptions{}).
+				Return(nil, k8serrors.NewNotFound(schema.GroupResource{}, "my-service-account"))
+			expectedOptions := metav1.PatchOptions{FieldManager: testFieldManagerName, Force: tt.expectedForce}
+			apiInterfaceMock.EXPECT().Patch(mock.Anything, "my-service-account", types.ApplyPatchType, mock.Anything, expectedOptions).
+				Return(&unstructured.Unstructured{Object: map[string]interface{}{}}, nil)
+
+			sut.forceConflicts = tt.forceConflicts
+
+			// when
+			err := sut.Apply(testServiceAccount, "my-namespace")
+
+			// then
+			require.NoError(t, err)
+		})
+	}
+}
+
+func Test_Applier_log(t *testing.T) {
+	t.Run("should log with the given logger", func(t *testing.T) {
+		// given
+		out := &bytes.Buffer{}
+		logger := logrus.New()
+		logger.SetOutput(out)
+		logger.SetLevel(logrus.DebugLevel)
+
+		sut, apiInterfaceMock := newMappedApplier(t, testServiceAccountMapping, "my-namespace")
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "my-service-account", metav1.GetOptions{}).
+			Return(nil, k8serrors.NewNotFound(schema.GroupResource{}, "my-service-account"))
+		apiInterfaceMock.EXPECT().Patch(mock.Anything, "my-service-account", types.ApplyPatchType, mock.Anything, mock.Anything).
+			Return(&unstructured.Unstructured{Object: map[string]interface{}{}}, nil)
+
+		sut.logger = logger
+
+		// when
+		err := sut.Apply(testServiceAccount, "my-namespace")
+
+		// then
+		require.NoError(t, err)
+		assert.Contains(t, out.String(), "my-service-account")
+	})
+	t.Run("should fall back to GetLogger", func(t *testing.T) {
+		// given
+		sut := &Applier{}
+
+		// when
+		actual := sut.log()
+
+		// then
+		assert.Equal(t, GetLogger(), actual)
+	})
+}
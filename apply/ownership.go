@@ -0,0 +1,411 @@
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+const (
+	// OwnerLabelPrefix starts the keys of the labels which mark resources that cannot reference their owner, f. i.
+	// cluster-scoped resources of a namespaced owner. Each key ends with the UID of an owner, see OwnerLabel, so that a
+	// resource can be marked for several owners. An annotation with the same key names the owner as
+	// "<apiVersion>/<kind>/<namespace>/<name>". Use Applier.DeleteOwnedResources to delete these resources.
+	OwnerLabelPrefix = "owner.k8s.cloudogu.com/"
+	// OwnerLabelValue is the value of the owner labels.
+	OwnerLabelValue = "true"
+	// OwnedResourcesFinalizer is a finalizer for owners which keeps the owner until the resources with the owner label
+	// were deleted. Applier.FinalizeOwnedResources adds and removes it.
+	OwnedResourcesFinalizer = "k8s.cloudogu.com/owned-resources-cleanup"
+)
+
+// OwnerLabel returns the key of the label and annotation which mark resources of the owner with the given UID.
+func OwnerLabel(uid types.UID) string {
+	return OwnerLabelPrefix + string(uid)
+}
+
+// OwnerReference describes an owner of the applied resources.
+type OwnerReference struct {
+	// Owner is the owning resource. It must have a UID.
+	Owner metav1.Object
+	// Controller makes the owner the managing controller of the resources. A resource can only have one controller.
+	Controller bool
+	// BlockOwnerDeletion keeps the owner from being deleted in foreground until the resources were deleted.
+	BlockOwnerDeletion bool
+}
+
+// AlreadyOwnedError is returned if a resource should get a controller while another controller manages it already.
+type AlreadyOwnedError struct {
+	// Kind, Namespace and Name identify the resource.
+	Kind      string
+	Namespace string
+	Name      string
+	// Controller references the current controller of the resource.
+	Controller metav1.OwnerReference
+	// Owner references the owner which should have become the controller.
+	Owner metav1.OwnerReference
+}
+
+// Error returns the string representation of this error.
+func (e *AlreadyOwnedError) Error() string {
+	return fmt.Sprintf("%s %s/%s is already controlled by %s %s, %s %s cannot become its controller",
+		e.Kind, e.Namespace, e.Name, e.Controller.Kind, e.Controller.Name, e.Owner.Kind, e.Owner.Name)
+}
+
+// ownerReferences returns the owner references of the options. Owner is a shorthand for a blocking controller.
+func (opts ApplyOptions) ownerReferences() []OwnerReference {
+	if opts.Owner == nil {
+		return opts.OwnerReferences
+	}
+
+	controller := OwnerReference{Owner: opts.Owner, Controller: true, BlockOwnerDeletion: true}
+	return append([]OwnerReference{controller}, opts.OwnerReferences...)
+}
+
+// setOwners adds the owner references to the resource, see setOwner.
+func setOwners(refs []OwnerReference, resource *unstructured.Unstructured, namespaced bool, kinds ownerKindResolver) error {
+	for _, ref := range refs {
+		err := setOwner(ref, resource, namespaced, kinds)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setOwner adds the owner reference to the resource. Kubernetes only garbage-collects resources whose owner is
+// cluster-scoped or lives in the same namespace, so all other resources are marked with the owner label and annotation
+// instead, see OwnerLabelPrefix. An owner without namespace is considered cluster-scoped.
+func setOwner(ref OwnerReference, resource *unstructured.Unstructured, namespaced bool, kinds ownerKindResolver) error {
+	owner := ref.Owner
+	if owner.GetNamespace() != "" && (!namespaced || owner.GetNamespace() != resource.GetNamespace()) {
+		err := setOwnerLabels(owner, resource, kinds)
+		if err != nil {
+			return fmt.Errorf("could not set owner labels: %w", err)
+		}
+		return nil
+	}
+
+	err := setOwnerReference(ref, resource, kinds)
+	var alreadyOwnedErr *AlreadyOwnedError
+	if errors.As(err, &alreadyOwnedErr) {
+		return err
+	}
+	if err != nil && ref.Controller {
+		return fmt.Errorf("could not set controller reference: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("could not set owner reference: %w", err)
+	}
+	return nil
+}
+
+// setOwnerReference adds the reference or replaces an existing reference to the same owner. Other than
+// controllerutil.SetControllerReference, it does not need the owner's type to be registered in a scheme.
+func setOwnerReference(ref OwnerReference, resource *unstructured.Unstructured, kinds ownerKindResolver) error {
+	owner := ref.Owner
+	if owner.GetUID() == "" {
+		return fmt.Errorf("owner %s/%s has no UID", owner.GetNamespace(), owner.GetName())
+	}
+
+	gvk, err := kinds.groupVersionKind(owner)
+	if err != nil {
+		return err
+	}
+
+	ownerRef := metav1.OwnerReference{
+		APIVersion: gvk.GroupVersion().String(),
+		Kind:       gvk.Kind,
+		Name:       owner.GetName(),
+		UID:        owner.GetUID(),
+	}
+	if ref.Controller {
+		controller := metav1.GetControllerOfNoCopy(resource)
+		if controller != nil && controller.UID != owner.GetUID() {
+			return &AlreadyOwnedError{
+				Kind:       resource.GetKind(),
+				Namespace:  resource.GetNamespace(),
+				Name:       resource.GetName(),
+				Controller: *controller,
+				Owner:      ownerRef,
+			}
+		}
+		ownerRef.Controller = pointer.Bool(true)
+	}
+	if ref.BlockOwnerDeletion {
+		ownerRef.BlockOwnerDeletion = pointer.Bool(true)
+	}
+
+	ownerRefs := resource.GetOwnerReferences()
+	for i := range ownerRefs {
+		if ownerRefs[i].UID == owner.GetUID() {
+			ownerRefs[i] = ownerRef
+			resource.SetOwnerReferences(ownerRefs)
+			return nil
+		}
+	}
+	resource.SetOwnerReferences(append(ownerRefs, ownerRef))
+
+	return nil
+}
+
+// checkController fails with an AlreadyOwnedError if the live resource is managed by another controller than the
+// desired resource. Server-side apply would merge both owner references and the API server rejects resources with two
+// controllers with a less helpful message.
+func checkController(live, desired *unstructured.Unstructured) error {
+	desiredController := metav1.GetControllerOfNoCopy(desired)
+	if live == nil || desiredController == nil {
+		return nil
+	}
+
+	liveController := metav1.GetControllerOfNoCopy(live)
+	if liveController == nil || liveController.UID == desiredController.UID {
+		return nil
+	}
+
+	return &AlreadyOwnedError{
+		Kind:       desired.GetKind(),
+		Namespace:  desired.GetNamespace(),
+		Name:       desired.GetName(),
+		Controller: *liveController,
+		Owner:      *desiredController,
+	}
+}
+
+func setOwnerLabels(owner metav1.Object, resource *unstructured.Unstructured, kinds ownerKindResolver) error {
+	if owner.GetUID() == "" {
+		return fmt.Errorf("owner %s/%s has no UID", owner.GetNamespace(), owner.GetName())
+	}
+
+	gvk, err := kinds.groupVersionKind(owner)
+	if err != nil {
+		return err
+	}
+
+	key := OwnerLabel(owner.GetUID())
+	addLabels(resource, map[string]string{key: OwnerLabelValue})
+
+	annotations := resource.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[key] = fmt.Sprintf("%s/%s/%s/%s", gvk.GroupVersion().String(), gvk.Kind, owner.GetNamespace(), owner.GetName())
+	resource.SetAnnotations(annotations)
+
+	return nil
+}
+
+// ownerKindResolver determines the kind of owners. Typed owners must either be registered in the scheme or carry
+// their TypeMeta. Otherwise, the kind is looked up in the fallback scheme and by the name of the owner's Go type in the
+// REST mapper, if any.
+type ownerKindResolver struct {
+	scheme         *runtime.Scheme
+	fallbackScheme *runtime.Scheme
+	mapper         meta.RESTMapper
+}
+
+func (ac *Applier) ownerKinds() ownerKindResolver {
+	return ownerKindResolver{scheme: ac.scheme, mapper: ac.gvrMapper}
+}
+
+func (r ownerKindResolver) groupVersionKind(owner metav1.Object) (schema.GroupVersionKind, error) {
+	ownerObject, ok := owner.(runtime.Object)
+	if !ok {
+		return schema.GroupVersionKind{}, fmt.Errorf("owner %s/%s is not a runtime.Object", owner.GetNamespace(), owner.GetName())
+	}
+
+	if r.scheme != nil {
+		gvk, err := apiutil.GVKForObject(ownerObject, r.scheme)
+		if err == nil {
+			return gvk, nil
+		}
+	}
+
+	gvk := ownerObject.GetObjectKind().GroupVersionKind()
+	if gvk.Kind != "" && gvk.Version != "" {
+		return gvk, nil
+	}
+
+	if r.fallbackScheme != nil {
+		gvk, err := apiutil.GVKForObject(ownerObject, r.fallbackScheme)
+		if err == nil {
+			return gvk, nil
+		}
+	}
+
+	kind := gvk.Kind
+	if kind == "" {
+		kind = reflect.Indirect(reflect.ValueOf(ownerObject)).Type().Name()
+	}
+	if r.mapper != nil && kind != "" {
+		plural, _ := meta.UnsafeGuessKindToResource(schema.GroupVersionKind{Kind: kind})
+		mapped, err := r.mapper.KindFor(plural)
+		if err == nil && mapped.Kind == kind {
+			return mapped, nil
+		}
+	}
+
+	return schema.GroupVersionKind{}, fmt.Errorf("could not determine the kind of owner %s/%s: set its TypeMeta or register its type in the scheme, see NewWithScheme", owner.GetNamespace(), owner.GetName())
+}
+
+// OwnedResourcesOptions contains settings which control which resources are deleted by Applier.DeleteOwnedResources.
+type OwnedResourcesOptions struct {
+	// Kinds contains the kinds of resources which are searched for the owner label.
+	Kinds []schema.GroupVersionKind
+	// Namespaces contains the namespaces which are searched for namespaced resources. All namespaces are searched if
+	// it is empty.
+	Namespaces []string
+	// DryRun sends the deletions as server-side dry-run.
+	DryRun bool
+}
+
+// FinalizeOwnedResources cleans up the resources which Kubernetes does not garbage-collect for the owner with the help
+// of the OwnedResourcesFinalizer. Call it whenever the owner is reconciled, before applying resources for it:
+//
+//	finalized, err := applier.FinalizeOwnedResources(ctx, owner, apply.OwnedResourcesOptions{Kinds: kinds})
+//	if err != nil || finalized {
+//	  return ctrl.Result{}, err
+//	}
+//
+// While the owner is not being deleted, the finalizer is added to the owner. Once the owner is being deleted, the
+// owned resources are deleted like with DeleteOwnedResources and the finalizer is removed afterwards, so that
+// Kubernetes deletes the owner. The owner's finalizers and resource version are updated in place. The method returns
+// true if the owner is being deleted and nothing is left to clean up.
+func (ac *Applier) FinalizeOwnedResources(ctx context.Context, owner metav1.Object, opts OwnedResourcesOptions) (bool, error) {
+	hasFinalizer := false
+	finalizers := make([]string, 0, len(owner.GetFinalizers()))
+	for _, finalizer := range owner.GetFinalizers() {
+		if finalizer == OwnedResourcesFinalizer {
+			hasFinalizer = true
+			continue
+		}
+		finalizers = append(finalizers, finalizer)
+	}
+
+	if owner.GetDeletionTimestamp().IsZero() {
+		if hasFinalizer {
+			return false, nil
+		}
+		return false, ac.patchOwnerFinalizers(ctx, owner, append(owner.GetFinalizers(), OwnedResourcesFinalizer), opts.DryRun)
+	}
+	if !hasFinalizer {
+		return true, nil
+	}
+
+	_, err := ac.DeleteOwnedResources(ctx, owner, opts)
+	if err != nil {
+		return false, err
+	}
+
+	err = ac.patchOwnerFinalizers(ctx, owner, finalizers, opts.DryRun)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// patchOwnerFinalizers replaces the finalizers of the owner. The resource version of the owner is sent along so that
+// finalizers which were changed concurrently are not overwritten.
+func (ac *Applier) patchOwnerFinalizers(ctx context.Context, owner metav1.Object, finalizers []string, dryRun bool) error {
+	gvk, err := ac.ownerKinds().groupVersionKind(owner)
+	if err != nil {
+		return err
+	}
+
+	mapping, err := ac.restMapping(ctx, gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return fmt.Errorf("could not find GVK mapper for GroupKind=%v,Version=%s while updating finalizers: %w", gvk.GroupKind(), gvk.Version, err)
+	}
+
+	metadata := map[string]interface{}{"finalizers": finalizers}
+	if owner.GetResourceVersion() != "" {
+		metadata["resourceVersion"] = owner.GetResourceVersion()
+	}
+	patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return fmt.Errorf("could not create finalizer patch: %w", err)
+	}
+
+	patchOptions := metav1.PatchOptions{}
+	if dryRun {
+		patchOptions.DryRun = []string{metav1.DryRunAll}
+	}
+
+	ac.log().Debug(fmt.Sprintf("Updating finalizers of owner %s/%s/%s", gvk.Kind, owner.GetNamespace(), owner.GetName()))
+	patched, err := ac.dynClient.Resource(mapping.Resource).Namespace(owner.GetNamespace()).Patch(ctx, owner.GetName(), types.MergePatchType, patch, patchOptions)
+	if err != nil {
+		return NewResourceError(err, "error while updating finalizers of owner", gvk.Kind, gvk.GroupVersion().String(), owner.GetName())
+	}
+
+	if !dryRun {
+		owner.SetFinalizers(finalizers)
+		owner.SetResourceVersion(patched.GetResourceVersion())
+	}
+
+	return nil
+}
+
+// DeleteOwnedResources deletes all resources of the given kinds which carry the owner label of the owner, that is
+// all resources of the owner which Kubernetes does not garbage-collect. Use FinalizeOwnedResources to call it while
+// finalizing the owner. The deleted resources are returned.
+func (ac *Applier) DeleteOwnedResources(ctx context.Context, owner metav1.Object, opts OwnedResourcesOptions) ([]*unstructured.Unstructured, error) {
+	if owner.GetUID() == "" {
+		return nil, fmt.Errorf("owner %s/%s has no UID", owner.GetNamespace(), owner.GetName())
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{OwnerLabel(owner.GetUID()): OwnerLabelValue}).String()
+	deleteOptions := metav1.DeleteOptions{}
+	if opts.DryRun {
+		deleteOptions.DryRun = []string{metav1.DryRunAll}
+	}
+
+	deleted := make([]*unstructured.Unstructured, 0)
+	for _, gvk := range opts.Kinds {
+		mapping, err := ac.restMapping(ctx, gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return deleted, fmt.Errorf("could not find GVK mapper for GroupKind=%v,Version=%s while deleting owned resources: %w", gvk.GroupKind(), gvk.Version, err)
+		}
+
+		namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+		namespaces := opts.Namespaces
+		if !namespaced || len(namespaces) == 0 {
+			// an empty namespace lists cluster-scoped resources or namespaced resources of all namespaces
+			namespaces = []string{metav1.NamespaceAll}
+		}
+
+		for _, namespace := range namespaces {
+			list, err := ac.dynClient.Resource(mapping.Resource).Namespace(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return deleted, fmt.Errorf("could not list owned resources with selector %s: %w", selector, err)
+			}
+
+			for i := range list.Items {
+				resource := &list.Items[i]
+				ac.log().Debug(fmt.Sprintf("Deleting owned resource %s/%s/%s", resource.GetKind(), resource.GetAPIVersion(), resource.GetName()))
+				err = ac.dynClient.Resource(mapping.Resource).Namespace(resource.GetNamespace()).Delete(ctx, resource.GetName(), deleteOptions)
+				if err != nil && !k8serrors.IsNotFound(err) {
+					return deleted, NewResourceError(err, "error while deleting owned resource", resource.GetKind(), resource.GetAPIVersion(), resource.GetName())
+				}
+
+				deleted = append(deleted, resource)
+			}
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,519 @@
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+)
+
+func Test_setOwner(t *testing.T) {
+	newOwner := func(namespace string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: namespace, UID: "4711"}}
+	}
+	tests := []struct {
+		name              string
+		ownerNamespace    string
+		resourceNamespace string
+		namespaced        bool
+		wantReference     bool
+	}{
+		{name: "cluster-scoped owner of cluster-scoped resource", wantReference: true},
+		{name: "cluster-scoped owner of namespaced resource", resourceNamespace: "ecosystem", namespaced: true, wantReference: true},
+		{name: "owner in the same namespace", ownerNamespace: "ecosystem", resourceNamespace: "ecosystem", namespaced: true, wantReference: true},
+		{name: "owner in another namespace", ownerNamespace: "ecosystem", resourceNamespace: "monitoring", namespaced: true},
+		{name: "namespaced owner of cluster-scoped resource", ownerNamespace: "ecosystem"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			resource := &unstructured.Unstructured{}
+			resource.SetNamespace(tt.resourceNamespace)
+
+			// when
+			err := setOwner(OwnerReference{Owner: newOwner(tt.ownerNamespace), Controller: true, BlockOwnerDeletion: true}, resource, tt.namespaced, ownerKindResolver{scheme: clientgoscheme.Scheme})
+
+			// then
+			require.NoError(t, err)
+			if tt.wantReference {
+				require.Len(t, resource.GetOwnerReferences(), 1)
+				assert.Equal(t, "ConfigMap", resource.GetOwnerReferences()[0].Kind)
+				assert.Empty(t, resource.GetLabels())
+				return
+			}
+			assert.Empty(t, resource.GetOwnerReferences())
+			assert.Equal(t, map[string]string{"owner.k8s.cloudogu.com/4711": "true"}, resource.GetLabels())
+			assert.Equal(t, map[string]string{"owner.k8s.cloudogu.com/4711": "v1/ConfigMap/ecosystem/owner"}, resource.GetAnnotations())
+		})
+	}
+
+	t.Run("should fail for owners without UID", func(t *testing.T) {
+		// given
+		owner := newOwner("ecosystem")
+		owner.UID = ""
+
+		// when
+		err := setOwner(OwnerReference{Owner: owner}, &unstructured.Unstructured{}, false, ownerKindResolver{scheme: clientgoscheme.Scheme})
+
+		// then
+		require.Error(t, err)
+		assert.EqualError(t, err, "could not set owner labels: owner ecosystem/owner has no UID")
+	})
+}
+
+func Test_setOwners(t *testing.T) {
+	newOwner := func(name, uid string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ecosystem", UID: types.UID(uid)}}
+	}
+
+	t.Run("should add controller and non-controller owner references", func(t *testing.T) {
+		// given
+		resource := &unstructured.Unstructured{}
+		resource.SetNamespace("ecosystem")
+		refs := []OwnerReference{
+			{Owner: newOwner("controller", "1"), Controller: true, BlockOwnerDeletion: false},
+			{Owner: newOwner("blocking", "2"), BlockOwnerDeletion: true},
+			{Owner: newOwner("loose", "3")},
+		}
+
+		// when
+		err := setOwners(refs, resource, true, ownerKindResolver{scheme: clientgoscheme.Scheme})
+
+		// then
+		require.NoError(t, err)
+		expected := []metav1.OwnerReference{
+			{APIVersion: "v1", Kind: "ConfigMap", Name: "controller", UID: "1", Controller: pointer.Bool(true)},
+			{APIVersion: "v1", Kind: "ConfigMap", Name: "blocking", UID: "2", BlockOwnerDeletion: pointer.Bool(true)},
+			{APIVersion: "v1", Kind: "ConfigMap", Name: "loose", UID: "3"},
+		}
+		assert.Equal(t, expected, resource.GetOwnerReferences())
+	})
+	t.Run("should fail with AlreadyOwnedError for two controllers", func(t *testing.T) {
+		// given
+		resource := &unstructured.Unstructured{}
+		resource.SetKind("Secret")
+		resource.SetName("credentials")
+		resource.SetNamespace("ecosystem")
+		refs := []OwnerReference{
+			{Owner: newOwner("first", "1"), Controller: true},
+			{Owner: newOwner("second", "2"), Controller: true},
+		}
+
+		// when
+		err := setOwners(refs, resource, true, ownerKindResolver{scheme: clientgoscheme.Scheme})
+
+		// then
+		require.Error(t, err)
+		var alreadyOwnedErr *AlreadyOwnedError
+		require.ErrorAs(t, err, &alreadyOwnedErr)
+		assert.Equal(t, types.UID("1"), alreadyOwnedErr.Controller.UID)
+		assert.Equal(t, types.UID("2"), alreadyOwnedErr.Owner.UID)
+		assert.EqualError(t, err, "Secret ecosystem/credentials is already controlled by ConfigMap first, ConfigMap second cannot become its controller")
+	})
+	t.Run("should add one label per owner which cannot be referenced", func(t *testing.T) {
+		// given
+		resource := &unstructured.Unstructured{}
+		refs := []OwnerReference{{Owner: newOwner("first", "1")}, {Owner: newOwner("second", "2")}}
+
+		// when
+		err := setOwners(refs, resource, false, ownerKindResolver{scheme: clientgoscheme.Scheme})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{OwnerLabel("1"): "true", OwnerLabel("2"): "true"}, resource.GetLabels())
+		assert.Equal(t, map[string]string{
+			OwnerLabel("1"): "v1/ConfigMap/ecosystem/first",
+			OwnerLabel("2"): "v1/ConfigMap/ecosystem/second",
+		}, resource.GetAnnotations())
+	})
+}
+
+func Test_checkController(t *testing.T) {
+	newResource := func(controllerUID types.UID) *unstructured.Unstructured {
+		resource := &unstructured.Unstructured{}
+		resource.SetKind("Secret")
+		resource.SetName("credentials")
+		if controllerUID != "" {
+			resource.SetOwnerReferences([]metav1.OwnerReference{{Kind: "ConfigMap", Name: string(controllerUID), UID: controllerUID, Controller: pointer.Bool(true)}})
+		}
+		return resource
+	}
+
+	tests := []struct {
+		name    string
+		live    *unstructured.Unstructured
+		desired *unstructured.Unstructured
+		wantErr bool
+	}{
+		{name: "new resource", live: nil, desired: newResource("1")},
+		{name: "no desired controller", live: newResource("1"), desired: newResource("")},
+		{name: "live resource without controller", live: newResource(""), desired: newResource("1")},
+		{name: "same controller", live: newResource("1"), desired: newResource("1")},
+		{name: "other controller", live: newResource("1"), desired: newResource("2"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			err := checkController(tt.live, tt.desired)
+
+			// then
+			if !tt.wantErr {
+				require.NoError(t, err)
+				return
+			}
+			var alreadyOwnedErr *AlreadyOwnedError
+			require.ErrorAs(t, err, &alreadyOwnedErr)
+			assert.Equal(t, types.UID("1"), alreadyOwnedErr.Controller.UID)
+		})
+	}
+}
+
+func TestApplier_DeleteOwnedResources(t *testing.T) {
+	owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ecosystem", UID: "4711"}}
+	expectedListOptions := metav1.ListOptions{LabelSelector: "owner.k8s.cloudogu.com/4711=true"}
+	clusterRoleMapping := &meta.RESTMapping{
+		Resource:         schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"},
+		GroupVersionKind: schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"},
+		Scope:            meta.RESTScopeRoot,
+	}
+	configMapMapping := &meta.RESTMapping{
+		Resource:         schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+		Scope:            meta.RESTScopeNamespace,
+	}
+	newOwned := func(name, namespace string) unstructured.Unstructured {
+		owned := unstructured.Unstructured{}
+		owned.SetName(name)
+		owned.SetNamespace(namespace)
+		return owned
+	}
+
+	t.Run("should delete labelled resources of all kinds", func(t *testing.T) {
+		// given
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().RESTMapping(clusterRoleMapping.GroupVersionKind.GroupKind(), "v1").Return(clusterRoleMapping, nil)
+		gvrMapperMock.EXPECT().RESTMapping(configMapMapping.GroupVersionKind.GroupKind(), "v1").Return(configMapMapping, nil)
+
+		clusterRolesMock := newMockNamespaceInterface(t)
+		clusterRolesMock.EXPECT().Namespace("").Return(clusterRolesMock)
+		clusterRolesMock.EXPECT().List(mock.Anything, expectedListOptions).Return(&unstructured.UnstructuredList{
+			Items: []unstructured.Unstructured{newOwned("reader", "")},
+		}, nil)
+		clusterRolesMock.EXPECT().Delete(mock.Anything, "reader", metav1.DeleteOptions{}).Return(nil)
+
+		configMapsMock := newMockNamespaceInterface(t)
+		monitoringMock := newMockNamespaceInterface(t)
+		configMapsMock.EXPECT().Namespace("").Return(configMapsMock)
+		configMapsMock.EXPECT().List(mock.Anything, expectedListOptions).Return(&unstructured.UnstructuredList{
+			Items: []unstructured.Unstructured{newOwned("dashboard", "monitoring")},
+		}, nil)
+		configMapsMock.EXPECT().Namespace("monitoring").Return(monitoringMock)
+		notFound := k8serrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "dashboard")
+		monitoringMock.EXPECT().Delete(mock.Anything, "dashboard", metav1.DeleteOptions{}).Return(notFound)
+
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(clusterRoleMapping.Resource).Return(clusterRolesMock)
+		dynClientMock.EXPECT().Resource(configMapMapping.Resource).Return(configMapsMock)
+
+		sut := &Applier{gvrMapper: gvrMapperMock, dynClient: dynClientMock}
+
+		// when
+		actual, err := sut.DeleteOwnedResources(context.Background(), owner, OwnedResourcesOptions{
+			Kinds: []schema.GroupVersionKind{clusterRoleMapping.GroupVersionKind, configMapMapping.GroupVersionKind},
+		})
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, actual, 2)
+		assert.Equal(t, "reader", actual[0].GetName())
+		assert.Equal(t, "dashboard", actual[1].GetName())
+	})
+	t.Run("should only search the given namespaces", func(t *testing.T) {
+		// given
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().RESTMapping(configMapMapping.GroupVersionKind.GroupKind(), "v1").Return(configMapMapping, nil)
+
+		configMapsMock := newMockNamespaceInterface(t)
+		monitoringMock := newMockNamespaceInterface(t)
+		configMapsMock.EXPECT().Namespace("monitoring").Return(monitoringMock)
+		monitoringMock.EXPECT().List(mock.Anything, expectedListOptions).Return(&unstructured.UnstructuredList{
+			Items: []unstructured.Unstructured{newOwned("dashboard", "monitoring")},
+		}, nil)
+		monitoringMock.EXPECT().Delete(mock.Anything, "dashboard", metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}}).Return(assert.AnError)
+
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(configMapMapping.Resource).Return(configMapsMock)
+
+		sut := &Applier{gvrMapper: gvrMapperMock, dynClient: dynClientMock}
+
+		// when
+		actual, err := sut.DeleteOwnedResources(context.Background(), owner, OwnedResourcesOptions{
+			Kinds:      []schema.GroupVersionKind{configMapMapping.GroupVersionKind},
+			Namespaces: []string{"monitoring"},
+			DryRun:     true,
+		})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "error while deleting owned resource")
+		assert.Empty(t, actual)
+	})
+	t.Run("should fail for owners without UID", func(t *testing.T) {
+		// given
+		sut := &Applier{}
+
+		// when
+		_, err := sut.DeleteOwnedResources(context.Background(), &corev1.ConfigMap{}, OwnedResourcesOptions{})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "has no UID")
+	})
+}
+
+func TestApplier_FinalizeOwnedResources(t *testing.T) {
+	newOwner := func(deleting bool, finalizers ...string) *corev1.ConfigMap {
+		owner := &corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: testNamespace, UID: "4711", ResourceVersion: "1", Finalizers: finalizers},
+		}
+		if deleting {
+			now := metav1.Now()
+			owner.DeletionTimestamp = &now
+		}
+		return owner
+	}
+	patched := &unstructured.Unstructured{}
+	patched.SetResourceVersion("2")
+
+	t.Run("should add the finalizer to an owner which is not being deleted", func(t *testing.T) {
+		// given
+		owner := newOwner(false, "other")
+		sut, apiInterfaceMock := newMappedApplier(t, testConfigMapMapping, testNamespace)
+		expectedPatch := `{"metadata":{"finalizers":["other","k8s.cloudogu.com/owned-resources-cleanup"],"resourceVersion":"1"}}`
+		apiInterfaceMock.EXPECT().Patch(mock.Anything, "owner", types.MergePatchType, []byte(expectedPatch), metav1.PatchOptions{}).Return(patched, nil)
+
+		// when
+		finalized, err := sut.FinalizeOwnedResources(context.Background(), owner, OwnedResourcesOptions{})
+
+		// then
+		require.NoError(t, err)
+		assert.False(t, finalized)
+		assert.Equal(t, []string{"other", OwnedResourcesFinalizer}, owner.GetFinalizers())
+		assert.Equal(t, "2", owner.GetResourceVersion())
+	})
+	t.Run("should do nothing for an owner with finalizer which is not being deleted", func(t *testing.T) {
+		// given
+		sut := &Applier{}
+
+		// when
+		finalized, err := sut.FinalizeOwnedResources(context.Background(), newOwner(false, OwnedResourcesFinalizer), OwnedResourcesOptions{})
+
+		// then
+		require.NoError(t, err)
+		assert.False(t, finalized)
+	})
+	t.Run("should delete owned resources and remove the finalizer of a deleted owner", func(t *testing.T) {
+		// given
+		owner := newOwner(true, OwnedResourcesFinalizer, "other")
+		clusterRoleMapping := &meta.RESTMapping{
+			Resource:         schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"},
+			GroupVersionKind: schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"},
+			Scope:            meta.RESTScopeRoot,
+		}
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().RESTMapping(clusterRoleMapping.GroupVersionKind.GroupKind(), "v1").Return(clusterRoleMapping, nil)
+		gvrMapperMock.EXPECT().RESTMapping(testConfigMapMapping.GroupVersionKind.GroupKind(), "v1").Return(testConfigMapMapping, nil)
+
+		clusterRolesMock := newMockNamespaceInterface(t)
+		clusterRolesMock.EXPECT().Namespace("").Return(clusterRolesMock)
+		reader := unstructured.Unstructured{}
+		reader.SetName("reader")
+		clusterRolesMock.EXPECT().List(mock.Anything, metav1.ListOptions{LabelSelector: "owner.k8s.cloudogu.com/4711=true"}).
+			Return(&unstructured.UnstructuredList{Items: []unstructured.Unstructured{reader}}, nil)
+		clusterRolesMock.EXPECT().Delete(mock.Anything, "reader", metav1.DeleteOptions{}).Return(nil)
+
+		configMapsMock := newMockNamespaceInterface(t)
+		configMapsMock.EXPECT().Namespace(testNamespace).Return(configMapsMock)
+		expectedPatch := `{"metadata":{"finalizers":["other"],"resourceVersion":"1"}}`
+		configMapsMock.EXPECT().Patch(mock.Anything, "owner", types.MergePatchType, []byte(expectedPatch), metav1.PatchOptions{}).Return(patched, nil)
+
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(clusterRoleMapping.Resource).Return(clusterRolesMock)
+		dynClientMock.EXPECT().Resource(testConfigMapMapping.Resource).Return(configMapsMock)
+
+		sut := &Applier{gvrMapper: gvrMapperMock, dynClient: dynClientMock}
+
+		// when
+		finalized, err := sut.FinalizeOwnedResources(context.Background(), owner, OwnedResourcesOptions{
+			Kinds: []schema.GroupVersionKind{clusterRoleMapping.GroupVersionKind},
+		})
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, finalized)
+		assert.Equal(t, []string{"other"}, owner.GetFinalizers())
+	})
+	t.Run("should keep the finalizer if owned resources cannot be deleted", func(t *testing.T) {
+		// given
+		owner := newOwner(true, OwnedResourcesFinalizer)
+		sut, apiInterfaceMock := newMappedApplier(t, testConfigMapMapping, "")
+		apiInterfaceMock.EXPECT().List(mock.Anything, mock.Anything).Return(nil, assert.AnError)
+
+		// when
+		finalized, err := sut.FinalizeOwnedResources(context.Background(), owner, OwnedResourcesOptions{
+			Kinds: []schema.GroupVersionKind{testConfigMapMapping.GroupVersionKind},
+		})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.False(t, finalized)
+		assert.Equal(t, []string{OwnedResourcesFinalizer}, owner.GetFinalizers())
+	})
+	t.Run("should report a deleted owner without finalizer as finalized", func(t *testing.T) {
+		// given
+		sut := &Applier{}
+
+		// when
+		finalized, err := sut.FinalizeOwnedResources(context.Background(), newOwner(true), OwnedResourcesOptions{})
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, finalized)
+	})
+}
+
+func TestApplier_ApplyWithOptions_ownerReferences(t *testing.T) {
+	t.Run("should not patch a resource which is controlled by another owner", func(t *testing.T) {
+		// given
+		mockedRestMapping := &meta.RESTMapping{
+			Resource:         schema.GroupVersionResource{Version: "v1", Resource: "secrets"},
+			GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "Secret"},
+			Scope:            meta.RESTScopeNamespace,
+		}
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().RESTMapping(schema.GroupKind{Kind: "Secret"}, "v1").Return(mockedRestMapping, nil)
+
+		live := &unstructured.Unstructured{}
+		live.SetOwnerReferences([]metav1.OwnerReference{{Kind: "Deployment", Name: "other", UID: "other", Controller: pointer.Bool(true)}})
+		apiInterfaceMock := newMockNamespaceInterface(t)
+		apiInterfaceMock.EXPECT().Namespace("ecosystem").Return(apiInterfaceMock)
+		apiInterfaceMock.EXPECT().Get(mock.Anything, "credentials", metav1.GetOptions{}).Return(live, nil)
+
+		dynClientMock := newMockDynClient(t)
+		dynClientMock.EXPECT().Resource(mock.Anything).Return(apiInterfaceMock)
+
+		sut := &Applier{gvrMapper: gvrMapperMock, dynClient: dynClientMock, scheme: clientgoscheme.Scheme}
+		owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ecosystem", UID: "4711"}}
+		testResource := []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: credentials\n")
+
+		// when
+		_, err := sut.ApplyWithOptions(context.Background(), testResource, "ecosystem", ApplyOptions{
+			OwnerReferences: []OwnerReference{{Owner: owner, Controller: true}},
+		})
+
+		// then
+		require.Error(t, err)
+		var resourceErr *ResourceError
+		require.ErrorAs(t, err, &resourceErr)
+		var alreadyOwnedErr *AlreadyOwnedError
+		require.ErrorAs(t, err, &alreadyOwnedErr)
+		assert.Equal(t, "other", alreadyOwnedErr.Controller.Name)
+		assert.ErrorContains(t, err, "error while setting owner")
+	})
+}
+
+func TestBuilder_WithOwnerReference(t *testing.T) {
+	t.Run("should pass all owners to the applier", func(t *testing.T) {
+		// given
+		first := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "first"}}
+		second := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "second"}}
+		doc := YamlDocument("apiVersion: v1\nkind: Secret\nmetadata:\n  name: credentials\n")
+		expectedOptions := ApplyOptions{OwnerReferences: []OwnerReference{
+			{Owner: first, Controller: true, BlockOwnerDeletion: true},
+			{Owner: second},
+		}}
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", mock.Anything, doc, "ecosystem", expectedOptions).Return(&ResourceResult{}, nil)
+
+		sut := NewBuilder(mockedApplier).
+			WithNamespace("ecosystem").
+			WithOwnerReference(first, true, true).
+			WithOwnerReference(second, false, false).
+			WithYamlResource("secret.yaml", doc)
+
+		// when
+		err := sut.ExecuteApply()
+
+		// then
+		require.NoError(t, err)
+		mockedApplier.AssertExpectations(t)
+	})
+}
+
+func Test_ownerKindResolver_groupVersionKind(t *testing.T) {
+	deploymentKind := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+
+	t.Run("should use the scheme", func(t *testing.T) {
+		// given
+		sut := ownerKindResolver{scheme: clientgoscheme.Scheme}
+
+		// when
+		actual, err := sut.groupVersionKind(&appsv1.Deployment{})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, deploymentKind, actual)
+	})
+	t.Run("should use the TypeMeta of owners which are not registered", func(t *testing.T) {
+		// given
+		sut := ownerKindResolver{scheme: runtime.NewScheme()}
+		owner := &appsv1.Deployment{TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"}}
+
+		// when
+		actual, err := sut.groupVersionKind(owner)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, deploymentKind, actual)
+	})
+	t.Run("should look up the type name in the REST mapper", func(t *testing.T) {
+		// given
+		gvrMapperMock := newMockGvrMapper(t)
+		gvrMapperMock.EXPECT().KindFor(schema.GroupVersionResource{Resource: "deployments"}).Return(deploymentKind, nil)
+		sut := ownerKindResolver{scheme: runtime.NewScheme(), mapper: gvrMapperMock}
+
+		// when
+		actual, err := sut.groupVersionKind(&appsv1.Deployment{})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, deploymentKind, actual)
+	})
+	t.Run("should fail without scheme, TypeMeta and REST mapper", func(t *testing.T) {
+		// given
+		sut := ownerKindResolver{}
+
+		// when
+		_, err := sut.groupVersionKind(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ecosystem"}})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "could not determine the kind of owner ecosystem/owner")
+	})
+}
@@ -0,0 +1,405 @@
+package apply
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// ReadinessStatus describes whether a resource reached its desired state.
+type ReadinessStatus string
+
+const (
+	// ReadinessStatusReady marks a resource which reached its desired state.
+	ReadinessStatusReady ReadinessStatus = "Ready"
+	// ReadinessStatusInProgress marks a resource which is still being reconciled.
+	ReadinessStatusInProgress ReadinessStatus = "InProgress"
+	// ReadinessStatusFailed marks a resource which will not reach its desired state without intervention.
+	ReadinessStatusFailed ReadinessStatus = "Failed"
+)
+
+// ResourceStatus describes the readiness of a single resource.
+type ResourceStatus struct {
+	// GroupVersionKind identifies the type of the resource.
+	GroupVersionKind schema.GroupVersionKind
+	// Namespace contains the namespace of the resource. It is empty for cluster-scoped resources.
+	Namespace string
+	// Name contains the name of the resource.
+	Name string
+	// Status tells whether the resource is ready.
+	Status ReadinessStatus
+	// Message explains why a resource is not ready.
+	Message string
+}
+
+// String returns the string representation of this status.
+func (s ResourceStatus) String() string {
+	resource := fmt.Sprintf("%s/%s", s.GroupVersionKind.Kind, s.Name)
+	if s.Namespace != "" {
+		resource = fmt.Sprintf("%s/%s/%s", s.GroupVersionKind.Kind, s.Namespace, s.Name)
+	}
+	if s.Message == "" {
+		return fmt.Sprintf("%s (%s)", resource, s.Status)
+	}
+	return fmt.Sprintf("%s (%s: %s)", resource, s.Status, s.Message)
+}
+
+// WaitOptions contains settings which control how long Applier.WaitForReady waits.
+type WaitOptions struct {
+	// Timeout limits the total time to wait for all resources. A timeout of zero or less sets no deadline so that only
+	// the context passed to Applier.WaitForReady limits the wait.
+	Timeout time.Duration
+}
+
+// WaitError is returned when not all resources became ready, either because the timeout was exceeded or because a
+// resource failed.
+type WaitError struct {
+	err      error
+	statuses []ResourceStatus
+}
+
+// Error returns the string representation of this error.
+func (e *WaitError) Error() string {
+	unready := make([]string, 0)
+	for _, status := range e.NotReady() {
+		unready = append(unready, status.String())
+	}
+
+	return fmt.Sprintf("%d resource(s) are not ready [%s]: %+v", len(unready), strings.Join(unready, ", "), e.err)
+}
+
+// Unwrap returns the original error.
+func (e *WaitError) Unwrap() error {
+	return e.err
+}
+
+// NotReady returns the statuses of all resources which are not ready.
+func (e *WaitError) NotReady() []ResourceStatus {
+	unready := make([]ResourceStatus, 0)
+	for _, status := range e.statuses {
+		if status.Status != ReadinessStatusReady {
+			unready = append(unready, status)
+		}
+	}
+
+	return unready
+}
+
+// WaitForReady watches the given resources until all of them are ready, one of them failed or the timeout is
+// exceeded. Readiness is checked with kstatus-like rules: Deployments, StatefulSets and DaemonSets must have completed
+// their rollout, Jobs must have succeeded, CRDs must be established, PVCs must be bound and other resources must report
+// a true Ready condition if they have one. Each resource is listed once and then watched by its name, so the API
+// server is not polled. The last observed status of each resource is returned. If not all resources are ready, a
+// *WaitError names the unready resources.
+func (ac *Applier) WaitForReady(ctx context.Context, resources []*unstructured.Unstructured, opts WaitOptions) ([]ResourceStatus, error) {
+	waitCtx, cancel := context.WithCancel(ctx)
+	if opts.Timeout > 0 {
+		waitCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	defer cancel()
+
+	statuses := make([]ResourceStatus, len(resources))
+	errs := make([]error, len(resources))
+	var wg sync.WaitGroup
+	for i, resource := range resources {
+		statuses[i] = newResourceStatus(resource, ReadinessStatusInProgress, "not checked yet")
+
+		wg.Add(1)
+		go func(i int, resource *unstructured.Unstructured) {
+			defer wg.Done()
+			errs[i] = ac.watchReadiness(waitCtx, resource, &statuses[i])
+			if errs[i] != nil || statuses[i].Status == ReadinessStatusFailed {
+				// there is no need to wait for the other resources anymore
+				cancel()
+			}
+		}(i, resource)
+	}
+	wg.Wait()
+
+	var err error
+	for _, resourceErr := range errs {
+		if resourceErr != nil && !errors.Is(resourceErr, context.Canceled) && !errors.Is(resourceErr, context.DeadlineExceeded) {
+			err = resourceErr
+			break
+		}
+	}
+
+	switch {
+	case hasStatus(statuses, ReadinessStatusFailed):
+		return statuses, &WaitError{err: fmt.Errorf("at least one resource failed"), statuses: statuses}
+	case ctx.Err() != nil:
+		return statuses, &WaitError{err: ctx.Err(), statuses: statuses}
+	case err != nil:
+		return statuses, err
+	case waitCtx.Err() != nil && hasStatus(statuses, ReadinessStatusInProgress):
+		return statuses, &WaitError{err: fmt.Errorf("timed out after %s: %w", opts.Timeout, waitCtx.Err()), statuses: statuses}
+	}
+
+	return statuses, nil
+}
+
+func hasStatus(statuses []ResourceStatus, wanted ReadinessStatus) bool {
+	for _, status := range statuses {
+		if status.Status == wanted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watchReadiness lists the resource and watches it from the listed resource version until it is ready or failed.
+// The status is updated with every observed change. If the API server closes the watch, the resource is listed again.
+func (ac *Applier) watchReadiness(ctx context.Context, resource *unstructured.Unstructured, status *ResourceStatus) error {
+	gvk := resource.GroupVersionKind()
+	mapping, err := ac.restMapping(ctx, gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return fmt.Errorf("could not find GVK mapper for GroupKind=%v,Version=%s while waiting: %w", gvk.GroupKind(), gvk.Version, err)
+	}
+
+	client := ac.dynClient.Resource(mapping.Resource).Namespace(resource.GetNamespace())
+	listOptions := metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", resource.GetName()).String()}
+	for {
+		list, err := client.List(ctx, listOptions)
+		if err != nil {
+			return NewResourceError(err, "error while checking readiness", resource.GetKind(), resource.GetAPIVersion(), resource.GetName())
+		}
+
+		*status = newResourceStatus(resource, ReadinessStatusInProgress, "resource not found")
+		for i := range list.Items {
+			*status = readinessOf(&list.Items[i])
+		}
+		if status.Status != ReadinessStatusInProgress {
+			return nil
+		}
+
+		watchOptions := listOptions
+		watchOptions.ResourceVersion = list.GetResourceVersion()
+		watcher, err := client.Watch(ctx, watchOptions)
+		if err != nil {
+			return NewResourceError(err, "error while watching readiness", resource.GetKind(), resource.GetAPIVersion(), resource.GetName())
+		}
+
+		done, err := watchEvents(ctx, watcher, resource, status)
+		watcher.Stop()
+		if done || err != nil {
+			return err
+		}
+	}
+}
+
+// watchEvents updates the status with the events of the watcher until the resource is ready or failed. It returns
+// false without error if the watch ended and must be started again.
+func watchEvents(ctx context.Context, watcher watch.Interface, resource *unstructured.Unstructured, status *ResourceStatus) (bool, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return false, nil
+			}
+
+			switch event.Type {
+			case watch.Error:
+				// f. i. the resource version expired, so the resource must be listed again
+				return false, nil
+			case watch.Deleted:
+				*status = newResourceStatus(resource, ReadinessStatusInProgress, "resource not found")
+			case watch.Added, watch.Modified:
+				live, ok := event.Object.(*unstructured.Unstructured)
+				if !ok {
+					continue
+				}
+				*status = readinessOf(live)
+				if status.Status != ReadinessStatusInProgress {
+					return true, nil
+				}
+			}
+		}
+	}
+}
+
+func readinessOf(live *unstructured.Unstructured) ResourceStatus {
+	status, message := computeReadiness(live)
+	return newResourceStatus(live, status, message)
+}
+
+func newResourceStatus(resource *unstructured.Unstructured, status ReadinessStatus, message string) ResourceStatus {
+	return ResourceStatus{
+		GroupVersionKind: resource.GroupVersionKind(),
+		Namespace:        resource.GetNamespace(),
+		Name:             resource.GetName(),
+		Status:           status,
+		Message:          message,
+	}
+}
+
+// computeReadiness applies the readiness rules for the kind of the given resource.
+func computeReadiness(resource *unstructured.Unstructured) (ReadinessStatus, string) {
+	observedGeneration, found, _ := unstructured.NestedInt64(resource.Object, "status", "observedGeneration")
+	if found && observedGeneration < resource.GetGeneration() {
+		return ReadinessStatusInProgress, fmt.Sprintf("generation %d not observed yet", resource.GetGeneration())
+	}
+
+	gk := resource.GroupVersionKind().GroupKind()
+	switch gk {
+	case schema.GroupKind{Group: "apps", Kind: "Deployment"}:
+		return deploymentReadiness(resource)
+	case schema.GroupKind{Group: "apps", Kind: "StatefulSet"}:
+		return statefulSetReadiness(resource)
+	case schema.GroupKind{Group: "apps", Kind: "DaemonSet"}:
+		return daemonSetReadiness(resource)
+	case schema.GroupKind{Group: "batch", Kind: "Job"}:
+		return jobReadiness(resource)
+	case schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:
+		return crdReadiness(resource)
+	case schema.GroupKind{Kind: "PersistentVolumeClaim"}:
+		return pvcReadiness(resource)
+	default:
+		return genericReadiness(resource)
+	}
+}
+
+func deploymentReadiness(resource *unstructured.Unstructured) (ReadinessStatus, string) {
+	progressing := findCondition(resource, "Progressing")
+	if progressing != nil && progressing["reason"] == "ProgressDeadlineExceeded" {
+		return ReadinessStatusFailed, fmt.Sprintf("progress deadline exceeded: %v", progressing["message"])
+	}
+
+	replicas := specReplicas(resource)
+	updated := statusInt(resource, "updatedReplicas")
+	current := statusInt(resource, "replicas")
+	available := statusInt(resource, "availableReplicas")
+
+	switch {
+	case updated < replicas:
+		return ReadinessStatusInProgress, fmt.Sprintf("%d of %d replicas updated", updated, replicas)
+	case current > updated:
+		return ReadinessStatusInProgress, fmt.Sprintf("%d old replicas pending termination", current-updated)
+	case available < updated:
+		return ReadinessStatusInProgress, fmt.Sprintf("%d of %d updated replicas available", available, updated)
+	}
+
+	return ReadinessStatusReady, ""
+}
+
+func statefulSetReadiness(resource *unstructured.Unstructured) (ReadinessStatus, string) {
+	replicas := specReplicas(resource)
+	ready := statusInt(resource, "readyReplicas")
+	if ready < replicas {
+		return ReadinessStatusInProgress, fmt.Sprintf("%d of %d replicas ready", ready, replicas)
+	}
+
+	strategy, _, _ := unstructured.NestedString(resource.Object, "spec", "updateStrategy", "type")
+	if strategy == "OnDelete" {
+		return ReadinessStatusReady, ""
+	}
+
+	updated := statusInt(resource, "updatedReplicas")
+	partition, _, _ := unstructured.NestedInt64(resource.Object, "spec", "updateStrategy", "rollingUpdate", "partition")
+	if updated < replicas-partition {
+		return ReadinessStatusInProgress, fmt.Sprintf("%d of %d replicas updated", updated, replicas-partition)
+	}
+
+	currentRevision, _, _ := unstructured.NestedString(resource.Object, "status", "currentRevision")
+	updateRevision, _, _ := unstructured.NestedString(resource.Object, "status", "updateRevision")
+	if partition == 0 && currentRevision != updateRevision {
+		return ReadinessStatusInProgress, fmt.Sprintf("revision %s not rolled out yet", updateRevision)
+	}
+
+	return ReadinessStatusReady, ""
+}
+
+func daemonSetReadiness(resource *unstructured.Unstructured) (ReadinessStatus, string) {
+	desired := statusInt(resource, "desiredNumberScheduled")
+	updated := statusInt(resource, "updatedNumberScheduled")
+	available := statusInt(resource, "numberAvailable")
+
+	switch {
+	case updated < desired:
+		return ReadinessStatusInProgress, fmt.Sprintf("%d of %d pods updated", updated, desired)
+	case available < desired:
+		return ReadinessStatusInProgress, fmt.Sprintf("%d of %d pods available", available, desired)
+	}
+
+	return ReadinessStatusReady, ""
+}
+
+func jobReadiness(resource *unstructured.Unstructured) (ReadinessStatus, string) {
+	if isConditionTrue(resource, "Failed") {
+		return ReadinessStatusFailed, fmt.Sprintf("job failed: %v", findCondition(resource, "Failed")["message"])
+	}
+	if isConditionTrue(resource, "Complete") {
+		return ReadinessStatusReady, ""
+	}
+
+	return ReadinessStatusInProgress, "job not completed yet"
+}
+
+func crdReadiness(resource *unstructured.Unstructured) (ReadinessStatus, string) {
+	if isConditionTrue(resource, "Established") {
+		return ReadinessStatusReady, ""
+	}
+
+	return ReadinessStatusInProgress, "CRD not established yet"
+}
+
+func pvcReadiness(resource *unstructured.Unstructured) (ReadinessStatus, string) {
+	phase, _, _ := unstructured.NestedString(resource.Object, "status", "phase")
+	if phase == "Bound" {
+		return ReadinessStatusReady, ""
+	}
+
+	return ReadinessStatusInProgress, fmt.Sprintf("claim is in phase %q", phase)
+}
+
+// genericReadiness treats resources without a Ready condition, f. i. ConfigMaps, as ready once they exist.
+func genericReadiness(resource *unstructured.Unstructured) (ReadinessStatus, string) {
+	ready := findCondition(resource, "Ready")
+	if ready == nil || ready["status"] == string(metav1.ConditionTrue) {
+		return ReadinessStatusReady, ""
+	}
+
+	return ReadinessStatusInProgress, fmt.Sprintf("not ready: %v", ready["message"])
+}
+
+func findCondition(resource *unstructured.Unstructured, conditionType string) map[string]interface{} {
+	conditions, _, _ := unstructured.NestedSlice(resource.Object, "status", "conditions")
+	for _, rawCondition := range conditions {
+		condition, ok := rawCondition.(map[string]interface{})
+		if ok && condition["type"] == conditionType {
+			return condition
+		}
+	}
+
+	return nil
+}
+
+func isConditionTrue(resource *unstructured.Unstructured, conditionType string) bool {
+	condition := findCondition(resource, conditionType)
+	return condition != nil && condition["status"] == string(metav1.ConditionTrue)
+}
+
+func specReplicas(resource *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(resource.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+
+	return replicas
+}
+
+func statusInt(resource *unstructured.Unstructured, field string) int64 {
+	value, _, _ := unstructured.NestedInt64(resource.Object, "status", field)
+	return value
+}
@@ -0,0 +1,237 @@
+package apply
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/yaml"
+)
+
+func newUnstructuredFromYaml(t *testing.T, doc string) *unstructured.Unstructured {
+	t.Helper()
+
+	jsonDoc, err := yaml.YAMLToJSON([]byte(doc))
+	require.NoError(t, err)
+	resource := &unstructured.Unstructured{}
+	require.NoError(t, resource.UnmarshalJSON(jsonDoc))
+	return resource
+}
+
+func Test_computeReadiness(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+		want     ReadinessStatus
+	}{
+		{"deployment rolled out", `apiVersion: apps/v1
+kind: Deployment
+metadata: {generation: 2}
+spec: {replicas: 2}
+status: {observedGeneration: 2, replicas: 2, updatedReplicas: 2, availableReplicas: 2}`, ReadinessStatusReady},
+		{"deployment with unobserved generation", `apiVersion: apps/v1
+kind: Deployment
+metadata: {generation: 3}
+spec: {replicas: 2}
+status: {observedGeneration: 2, replicas: 2, updatedReplicas: 2, availableReplicas: 2}`, ReadinessStatusInProgress},
+		{"deployment with unavailable replicas", `apiVersion: apps/v1
+kind: Deployment
+spec: {replicas: 2}
+status: {replicas: 2, updatedReplicas: 2, availableReplicas: 1}`, ReadinessStatusInProgress},
+		{"deployment with old replicas", `apiVersion: apps/v1
+kind: Deployment
+spec: {replicas: 2}
+status: {replicas: 3, updatedReplicas: 2, availableReplicas: 2}`, ReadinessStatusInProgress},
+		{"deployment exceeding its progress deadline", `apiVersion: apps/v1
+kind: Deployment
+spec: {replicas: 2}
+status:
+  conditions: [{type: Progressing, status: "False", reason: ProgressDeadlineExceeded}]`, ReadinessStatusFailed},
+		{"statefulset rolled out", `apiVersion: apps/v1
+kind: StatefulSet
+spec: {replicas: 1}
+status: {readyReplicas: 1, updatedReplicas: 1, currentRevision: a, updateRevision: a}`, ReadinessStatusReady},
+		{"statefulset with pending revision", `apiVersion: apps/v1
+kind: StatefulSet
+spec: {replicas: 1}
+status: {readyReplicas: 1, updatedReplicas: 1, currentRevision: a, updateRevision: b}`, ReadinessStatusInProgress},
+		{"daemonset rolled out", `apiVersion: apps/v1
+kind: DaemonSet
+status: {desiredNumberScheduled: 3, updatedNumberScheduled: 3, numberAvailable: 3}`, ReadinessStatusReady},
+		{"daemonset with unavailable pods", `apiVersion: apps/v1
+kind: DaemonSet
+status: {desiredNumberScheduled: 3, updatedNumberScheduled: 3, numberAvailable: 2}`, ReadinessStatusInProgress},
+		{"job completed", `apiVersion: batch/v1
+kind: Job
+status:
+  conditions: [{type: Complete, status: "True"}]`, ReadinessStatusReady},
+		{"job running", `apiVersion: batch/v1
+kind: Job
+status: {active: 1}`, ReadinessStatusInProgress},
+		{"job failed", `apiVersion: batch/v1
+kind: Job
+status:
+  conditions: [{type: Failed, status: "True", message: BackoffLimitExceeded}]`, ReadinessStatusFailed},
+		{"crd established", `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+status:
+  conditions: [{type: Established, status: "True"}]`, ReadinessStatusReady},
+		{"crd not established", `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+status: {}`, ReadinessStatusInProgress},
+		{"pvc bound", `apiVersion: v1
+kind: PersistentVolumeClaim
+status: {phase: Bound}`, ReadinessStatusReady},
+		{"pvc pending", `apiVersion: v1
+kind: PersistentVolumeClaim
+status: {phase: Pending}`, ReadinessStatusInProgress},
+		{"resource without conditions", `apiVersion: v1
+kind: ConfigMap`, ReadinessStatusReady},
+		{"resource which is not ready", `apiVersion: example.com/v1
+kind: Dogu
+status:
+  conditions: [{type: Ready, status: "False"}]`, ReadinessStatusInProgress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, _ := computeReadiness(newUnstructuredFromYaml(t, tt.resource))
+			assert.Equal(t, tt.want, actual)
+		})
+	}
+}
+
+const testJobDoc = `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: le-job
+  namespace: le-namespace`
+
+func TestApplier_WaitForReady(t *testing.T) {
+	completedJob := newUnstructuredFromYaml(t, testJobDoc+`
+status:
+  conditions: [{type: Complete, status: "True"}]`)
+	runningJob := newUnstructuredFromYaml(t, testJobDoc+`
+status: {active: 1}`)
+	failedJob := newUnstructuredFromYaml(t, testJobDoc+`
+status:
+  conditions: [{type: Failed, status: "True", message: BackoffLimitExceeded}]`)
+	listOptions := metav1.ListOptions{FieldSelector: "metadata.name=le-job"}
+	watchOptions := metav1.ListOptions{FieldSelector: "metadata.name=le-job", ResourceVersion: "7"}
+	newList := func(items ...*unstructured.Unstructured) *unstructured.UnstructuredList {
+		list := &unstructured.UnstructuredList{}
+		list.SetResourceVersion("7")
+		for _, item := range items {
+			list.Items = append(list.Items, *item)
+		}
+		return list
+	}
+	newWatcher := func(events ...watch.Event) *watch.FakeWatcher {
+		watcher := watch.NewFakeWithChanSize(len(events), false)
+		for _, event := range events {
+			watcher.Action(event.Type, event.Object)
+		}
+		return watcher
+	}
+	opts := WaitOptions{Timeout: time.Second}
+
+	t.Run("should watch the resource until it is ready", func(t *testing.T) {
+		// given
+		sut, apiInterfaceMock := newMappedApplier(t, testJobMapping, testNamespace)
+		apiInterfaceMock.EXPECT().List(mock.Anything, listOptions).Return(newList(), nil).Once()
+		apiInterfaceMock.EXPECT().Watch(mock.Anything, watchOptions).Return(newWatcher(
+			watch.Event{Type: watch.Added, Object: runningJob},
+			watch.Event{Type: watch.Deleted, Object: runningJob},
+			watch.Event{Type: watch.Added, Object: completedJob},
+		), nil).Once()
+
+		// when
+		actual, err := sut.WaitForReady(context.Background(), []*unstructured.Unstructured{newUnstructuredFromYaml(t, testJobDoc)}, opts)
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, actual, 1)
+		assert.Equal(t, ReadinessStatusReady, actual[0].Status)
+		assert.Equal(t, "le-job", actual[0].Name)
+	})
+	t.Run("should list again after the watch was closed", func(t *testing.T) {
+		// given
+		sut, apiInterfaceMock := newMappedApplier(t, testJobMapping, testNamespace)
+		apiInterfaceMock.EXPECT().List(mock.Anything, listOptions).Return(newList(runningJob), nil).Once()
+		closedWatcher := newWatcher(watch.Event{Type: watch.Modified, Object: runningJob})
+		closedWatcher.Stop()
+		apiInterfaceMock.EXPECT().Watch(mock.Anything, watchOptions).Return(closedWatcher, nil).Once()
+		apiInterfaceMock.EXPECT().List(mock.Anything, listOptions).Return(newList(completedJob), nil).Once()
+
+		// when
+		actual, err := sut.WaitForReady(context.Background(), []*unstructured.Unstructured{newUnstructuredFromYaml(t, testJobDoc)}, opts)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, ReadinessStatusReady, actual[0].Status)
+	})
+	t.Run("should stop once a resource failed", func(t *testing.T) {
+		// given
+		sut, apiInterfaceMock := newMappedApplier(t, testJobMapping, testNamespace)
+		apiInterfaceMock.EXPECT().List(mock.Anything, listOptions).Return(newList(failedJob), nil)
+
+		// when
+		actual, err := sut.WaitForReady(context.Background(), []*unstructured.Unstructured{newUnstructuredFromYaml(t, testJobDoc)}, opts)
+
+		// then
+		require.Error(t, err)
+		var waitErr *WaitError
+		require.ErrorAs(t, err, &waitErr)
+		assert.Equal(t, actual, waitErr.NotReady())
+		assert.ErrorContains(t, err, "1 resource(s) are not ready [Job/le-namespace/le-job (Failed: job failed: BackoffLimitExceeded)]")
+	})
+	t.Run("should name unready resources after the timeout", func(t *testing.T) {
+		// given
+		sut, apiInterfaceMock := newMappedApplier(t, testJobMapping, testNamespace)
+		apiInterfaceMock.EXPECT().List(mock.Anything, listOptions).Return(newList(runningJob), nil)
+		apiInterfaceMock.EXPECT().Watch(mock.Anything, watchOptions).Return(newWatcher(), nil)
+
+		// when
+		_, err := sut.WaitForReady(context.Background(), []*unstructured.Unstructured{newUnstructuredFromYaml(t, testJobDoc)},
+			WaitOptions{Timeout: 20 * time.Millisecond})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorContains(t, err, "Job/le-namespace/le-job (InProgress: job not completed yet)")
+		assert.ErrorContains(t, err, "timed out after 20ms")
+	})
+	t.Run("should not set a deadline for a timeout of zero", func(t *testing.T) {
+		// given
+		sut, apiInterfaceMock := newMappedApplier(t, testJobMapping, testNamespace)
+		apiInterfaceMock.EXPECT().List(mock.Anything, listOptions).Return(newList(runningJob), nil)
+		apiInterfaceMock.EXPECT().Watch(mock.Anything, watchOptions).Return(newWatcher(watch.Event{Type: watch.Modified, Object: completedJob}), nil)
+
+		// when
+		actual, err := sut.WaitForReady(context.Background(), []*unstructured.Unstructured{newUnstructuredFromYaml(t, testJobDoc)},
+			WaitOptions{Timeout: 0})
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, actual, 1)
+		assert.Equal(t, ReadinessStatusReady, actual[0].Status)
+	})
+	t.Run("should return errors of the API server", func(t *testing.T) {
+		// given
+		sut, apiInterfaceMock := newMappedApplier(t, testJobMapping, testNamespace)
+		apiInterfaceMock.EXPECT().List(mock.Anything, listOptions).Return(nil, assert.AnError)
+
+		// when
+		_, err := sut.WaitForReady(context.Background(), []*unstructured.Unstructured{newUnstructuredFromYaml(t, testJobDoc)}, opts)
+
+		// then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorContains(t, err, "error while checking readiness")
+	})
+}
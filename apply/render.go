@@ -0,0 +1,213 @@
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// clusterScopedKinds contains the built-in kinds which are not namespaced. Rendering works without an API server, so
+// the scope of a kind cannot be discovered. Kinds which are neither listed here nor declared as cluster-scoped by a
+// CRD of the same Builder run are treated as namespaced.
+var clusterScopedKinds = map[schema.GroupKind]bool{
+	{Group: "", Kind: "Namespace"}:                                                  true,
+	{Group: "", Kind: "Node"}:                                                       true,
+	{Group: "", Kind: "PersistentVolume"}:                                           true,
+	{Group: "", Kind: "ComponentStatus"}:                                            true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:                       true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:                true,
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:               true,
+	{Group: "apiregistration.k8s.io", Kind: "APIService"}:                           true,
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"}:                             true,
+	{Group: "policy", Kind: "PodSecurityPolicy"}:                                    true,
+	{Group: "networking.k8s.io", Kind: "IngressClass"}:                              true,
+	{Group: "storage.k8s.io", Kind: "StorageClass"}:                                 true,
+	{Group: "storage.k8s.io", Kind: "CSIDriver"}:                                    true,
+	{Group: "storage.k8s.io", Kind: "CSINode"}:                                      true,
+	{Group: "storage.k8s.io", Kind: "VolumeAttachment"}:                             true,
+	{Group: "node.k8s.io", Kind: "RuntimeClass"}:                                    true,
+	{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"}:               true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:   true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"}: true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "FlowSchema"}:                     true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "PriorityLevelConfiguration"}:     true,
+}
+
+// RenderedDocument contains a resource as ExecuteApply would send it to the API server.
+type RenderedDocument struct {
+	DocumentReference
+	Object *unstructured.Unstructured
+}
+
+// RenderDocuments returns the resources as ExecuteApply would send them to the API server without contacting it. The
+// documents are rendered, split, sorted and filtered like during ExecuteApply. Collectors are not run. The namespace
+// is set for all namespaced resources, and namespaced resources get the owner reference and the ApplySet label if
+// configured. The Builder's applier is not used and may be nil.
+//
+// Custom resources are considered namespaced unless a CRD of the same run declares them as cluster-scoped.
+func (ab *Builder) RenderDocuments() ([]RenderedDocument, error) {
+	docs, err := ab.documents()
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err = sortDocumentsByKind(docs, false)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterScoped, err := clusterScopedCustomKinds(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	var rendered []RenderedDocument
+	for _, doc := range docs {
+		ok, err := ab.isFiltered(doc.Filename, doc.doc)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		obj, err := ab.renderResource(doc.doc, clusterScoped)
+		if err != nil {
+			return nil, fmt.Errorf("could not render document %s: %w", doc.DocumentReference, err)
+		}
+
+		rendered = append(rendered, RenderedDocument{DocumentReference: doc.DocumentReference, Object: obj})
+	}
+
+	return rendered, nil
+}
+
+// Render writes the resources returned by RenderDocuments as multi-document YAML.
+func (ab *Builder) Render(w io.Writer) error {
+	rendered, err := ab.RenderDocuments()
+	if err != nil {
+		return err
+	}
+
+	for i, doc := range rendered {
+		content, err := sigsyaml.Marshal(doc.Object.Object)
+		if err != nil {
+			return fmt.Errorf("could not encode document %s: %w", doc.DocumentReference, err)
+		}
+
+		if i > 0 {
+			_, err = io.WriteString(w, yamlDocumentSeparator+"\n")
+			if err != nil {
+				return err
+			}
+		}
+		_, err = w.Write(content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RenderJSON writes the resources returned by RenderDocuments as JSON v1.List like `kubectl get -o json` does.
+func (ab *Builder) RenderJSON(w io.Writer) error {
+	rendered, err := ab.RenderDocuments()
+	if err != nil {
+		return err
+	}
+
+	items := make([]interface{}, 0, len(rendered))
+	for _, doc := range rendered {
+		items = append(items, doc.Object.Object)
+	}
+	list := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(list)
+}
+
+// renderResource mirrors the preparation of a resource in Applier.ApplyWithOptions.
+func (ab *Builder) renderResource(doc YamlDocument, clusterScoped map[schema.GroupKind]bool) (*unstructured.Unstructured, error) {
+	var decUnstructured = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
+	obj := &unstructured.Unstructured{}
+	_, gvk, err := decUnstructured.Decode(doc, nil, obj)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode YAML document '%s': %w", string(doc), err)
+	}
+
+	opts := ab.applyOptions()
+	addLabels(obj, opts.Labels)
+
+	namespaced := !clusterScopedKinds[gvk.GroupKind()] && !clusterScoped[gvk.GroupKind()]
+	if namespaced {
+		namespace, err := resolveNamespace(obj, ab.namespace, ab.effectiveNamespacePolicy())
+		if err != nil {
+			return nil, err
+		}
+		obj.SetNamespace(namespace)
+	}
+
+	err = setOwners(opts.ownerReferences(), obj, namespaced, ab.ownerKinds())
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// ownerKinds resolves the kind of owners like the Applier does so that rendering produces the same owner references.
+// The REST mapper of the Applier is not used because rendering must not contact the API server. Instead, owners which
+// are unknown to the scheme of the Applier are looked up in the scheme of the built-in kinds.
+func (ab *Builder) ownerKinds() ownerKindResolver {
+	kinds := ownerKindResolver{fallbackScheme: clientgoscheme.Scheme}
+	if applier, ok := ab.applier.(*Applier); ok {
+		kinds.scheme = applier.scheme
+	}
+
+	return kinds
+}
+
+// clusterScopedCustomKinds returns the kinds which are declared as cluster-scoped by CRDs among the documents.
+func clusterScopedCustomKinds(docs []sourceDocument) (map[schema.GroupKind]bool, error) {
+	kinds := make(map[schema.GroupKind]bool)
+	for _, doc := range docs {
+		header, err := parseDocumentHeader(doc.doc)
+		if err != nil {
+			return nil, err
+		}
+		if header.groupKind() != crdGroupKind {
+			continue
+		}
+
+		var crd struct {
+			Spec struct {
+				Group string `json:"group"`
+				Scope string `json:"scope"`
+				Names struct {
+					Kind string `json:"kind"`
+				} `json:"names"`
+			} `json:"spec"`
+		}
+		err = sigsyaml.Unmarshal(doc.doc, &crd)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode CRD in document %s: %w", doc.DocumentReference, err)
+		}
+		if crd.Spec.Scope == "Cluster" {
+			kinds[schema.GroupKind{Group: crd.Spec.Group, Kind: crd.Spec.Names.Kind}] = true
+		}
+	}
+
+	return kinds, nil
+}
@@ -0,0 +1,196 @@
+package apply
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+const renderTestManifests = `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: app
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: clusterwidgets.example.com
+spec:
+  group: example.com
+  scope: Cluster
+  names:
+    kind: ClusterWidget
+---
+apiVersion: example.com/v1
+kind: ClusterWidget
+metadata:
+  name: global
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: {{ .Name }}
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ecosystem
+`
+
+func TestBuilder_RenderDocuments(t *testing.T) {
+	owner := &v1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ecosystem", UID: "4711"},
+	}
+
+	t.Run("should default namespaces and owners without an applier", func(t *testing.T) {
+		// given
+		sut := NewBuilder(nil).
+			WithNamespace("ecosystem").
+			WithOwner(owner).
+			WithYamlResource("app.yaml", []byte(renderTestManifests)).
+			WithTemplate("app.yaml", map[string]string{"Name": "local"})
+
+		// when
+		actual, err := sut.RenderDocuments()
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, actual, 5)
+
+		type rendered struct {
+			ref, kind, name, namespace string
+			owned, labelled            bool
+		}
+		var renderedDocs []rendered
+		for _, doc := range actual {
+			renderedDocs = append(renderedDocs, rendered{
+				ref:       doc.String(),
+				kind:      doc.Object.GetKind(),
+				name:      doc.Object.GetName(),
+				namespace: doc.Object.GetNamespace(),
+				owned:     len(doc.Object.GetOwnerReferences()) == 1,
+				labelled:  doc.Object.GetLabels()[OwnerLabel("4711")] == OwnerLabelValue,
+			})
+		}
+		expected := []rendered{
+			{ref: "app.yaml[4]", kind: "Namespace", name: "ecosystem", labelled: true},
+			{ref: "app.yaml[1]", kind: "CustomResourceDefinition", name: "clusterwidgets.example.com", labelled: true},
+			{ref: "app.yaml[0]", kind: "ServiceAccount", name: "app", namespace: "ecosystem", owned: true},
+			{ref: "app.yaml[2]", kind: "ClusterWidget", name: "global", labelled: true},
+			{ref: "app.yaml[3]", kind: "Widget", name: "local", namespace: "ecosystem", owned: true},
+		}
+		assert.Equal(t, expected, renderedDocs)
+
+		ownerRef := actual[2].Object.GetOwnerReferences()[0]
+		assert.Equal(t, "ConfigMap", ownerRef.Kind)
+		assert.Equal(t, "owner", ownerRef.Name)
+		assert.True(t, *ownerRef.Controller)
+	})
+	t.Run("should resolve typed owners without TypeMeta with an applier from New", func(t *testing.T) {
+		// given
+		applier, _, err := New(&rest.Config{}, testFieldManagerName)
+		require.NoError(t, err)
+		typedOwner := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ecosystem", UID: "4711"}}
+		sut := NewBuilder(applier).
+			WithNamespace("ecosystem").
+			WithOwner(typedOwner).
+			WithYamlResource("app.yaml", []byte("apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: app\n"))
+
+		// when
+		actual, err := sut.RenderDocuments()
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, actual, 1)
+		require.Len(t, actual[0].Object.GetOwnerReferences(), 1)
+		assert.Equal(t, "ConfigMap", actual[0].Object.GetOwnerReferences()[0].Kind)
+		assert.Equal(t, "v1", actual[0].Object.GetOwnerReferences()[0].APIVersion)
+	})
+	t.Run("should skip filtered documents without collecting them", func(t *testing.T) {
+		// given
+		collector := &predicatedNamespaceCollector{}
+		sut := NewBuilder(nil).
+			WithNamespace("ecosystem").
+			WithCollector(collector).
+			WithApplyFilter(&predicatedServiceAccountCollector{}).
+			WithYamlResource("app.yaml", []byte(renderTestManifests)).
+			WithTemplate("app.yaml", map[string]string{"Name": "local"})
+
+		// when
+		actual, err := sut.RenderDocuments()
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, actual, 1)
+		assert.Equal(t, "ServiceAccount", actual[0].Object.GetKind())
+		assert.Empty(t, collector.collected)
+	})
+	t.Run("should fail with the document reference for invalid documents", func(t *testing.T) {
+		// given
+		sut := NewBuilder(nil).
+			WithNamespace("ecosystem").
+			WithYamlResource("broken.yaml", []byte("apiVersion: v1\nmetadata:\n  name: no-kind\n"))
+
+		// when
+		_, err := sut.RenderDocuments()
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "could not render document broken.yaml[0]")
+	})
+}
+
+func TestBuilder_Render(t *testing.T) {
+	t.Run("should write multi-document YAML", func(t *testing.T) {
+		// given
+		sut := NewBuilder(nil).
+			WithNamespace("ecosystem").
+			WithYamlResource("app.yaml", []byte("apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: app\n---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: ecosystem\n"))
+		var out bytes.Buffer
+
+		// when
+		err := sut.Render(&out)
+
+		// then
+		require.NoError(t, err)
+		expected := `apiVersion: v1
+kind: Namespace
+metadata:
+  name: ecosystem
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: app
+  namespace: ecosystem
+`
+		assert.Equal(t, expected, out.String())
+	})
+}
+
+func TestBuilder_RenderJSON(t *testing.T) {
+	t.Run("should write a JSON list which can be applied again", func(t *testing.T) {
+		// given
+		sut := NewBuilder(nil).
+			WithNamespace("ecosystem").
+			WithYamlResource("app.yaml", []byte("apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: app\n"))
+		var out bytes.Buffer
+
+		// when
+		err := sut.RenderJSON(&out)
+
+		// then
+		require.NoError(t, err)
+		items, isList, err := expandDocument(out.Bytes())
+		require.NoError(t, err)
+		assert.True(t, isList)
+		require.Len(t, items, 1)
+		assert.Equal(t, "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: app\n  namespace: ecosystem\n", string(items[0]))
+	})
+}
@@ -1,6 +1,10 @@
 package apply
 
-import "fmt"
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
 
 // ResourceError wraps an original, Kubernetes-centric error and takes additional arguments to identify a K8s resource
 // by kind, version and name
@@ -10,6 +14,8 @@ type ResourceError struct {
 	kind          string
 	apiVersion    string
 	resourceName  string
+	namespace     string
+	document      DocumentReference
 }
 
 // NewResourceError creates a custom K8s error that identifies the resource by kind, version and name.
@@ -23,6 +29,35 @@ func NewResourceError(err error, wrapperErrMsg, kind, apiVersion, resourceName s
 	}
 }
 
+// newDocumentError creates a ResourceError for a YAML document of a Builder run which could not be applied. The
+// resource is identified by the resolved resource if the applier returned one. Otherwise, the document's header is
+// used and the namespace is determined by the given function.
+func newDocumentError(err error, doc sourceDocument, resolved *ResourceResult, namespaceOf func(header *documentHeader) string) *ResourceError {
+	resourceErr := &ResourceError{
+		err:           err,
+		wrapperErrMsg: fmt.Sprintf("could not apply document %s", doc.DocumentReference),
+		document:      doc.DocumentReference,
+	}
+
+	if resolved != nil {
+		resourceErr.kind = resolved.GroupVersionKind.Kind
+		resourceErr.apiVersion = resolved.GroupVersionKind.GroupVersion().String()
+		resourceErr.resourceName = resolved.Name
+		resourceErr.namespace = resolved.Namespace
+		return resourceErr
+	}
+
+	header, headerErr := parseDocumentHeader(doc.doc)
+	if headerErr == nil {
+		resourceErr.kind = header.Kind
+		resourceErr.apiVersion = header.APIVersion
+		resourceErr.resourceName = header.Metadata.Name
+		resourceErr.namespace = namespaceOf(header)
+	}
+
+	return resourceErr
+}
+
 // Error returns the string representation of this error.
 func (e *ResourceError) Error() string {
 	return fmt.Sprintf("%s (resource %s/%s/%s): %+v", e.wrapperErrMsg, e.kind, e.apiVersion, e.resourceName, e.err)
@@ -32,3 +67,23 @@ func (e *ResourceError) Error() string {
 func (e *ResourceError) Unwrap() error {
 	return e.err
 }
+
+// GroupVersionKind returns the type of the resource.
+func (e *ResourceError) GroupVersionKind() schema.GroupVersionKind {
+	return schema.FromAPIVersionAndKind(e.apiVersion, e.kind)
+}
+
+// Namespace returns the namespace of the resource. It is only set for errors of a Builder run.
+func (e *ResourceError) Namespace() string {
+	return e.namespace
+}
+
+// Name returns the name of the resource.
+func (e *ResourceError) Name() string {
+	return e.resourceName
+}
+
+// Document returns the YAML document the resource originates from. It is only set for errors of a Builder run.
+func (e *ResourceError) Document() DocumentReference {
+	return e.document
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/xerrors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"testing"
 )
 
@@ -38,3 +39,43 @@ func TestResourceError_Unwrap(t *testing.T) {
 
 	assert.Equal(t, assert.AnError, actual)
 }
+
+func Test_newDocumentError(t *testing.T) {
+	doc := sourceDocument{
+		DocumentReference: DocumentReference{Filename: testFile1, Index: 2},
+		doc:               YamlDocument("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: my-deployment\n  namespace: declared\n"),
+	}
+	namespaceOf := func(header *documentHeader) string {
+		return "resolved-" + header.Metadata.Namespace
+	}
+
+	t.Run("should identify document and resource by its header", func(t *testing.T) {
+		// when
+		sut := newDocumentError(assert.AnError, doc, nil, namespaceOf)
+
+		// then
+		assert.Equal(t, DocumentReference{Filename: testFile1, Index: 2}, sut.Document())
+		assert.Equal(t, schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, sut.GroupVersionKind())
+		assert.Equal(t, "resolved-declared", sut.Namespace())
+		assert.Equal(t, "my-deployment", sut.Name())
+		assert.Equal(t, "could not apply document /dir/file1.yaml[2] (resource Deployment/apps/v1/my-deployment): "+
+			"assert.AnError general error for testing", sut.Error())
+		assert.ErrorIs(t, sut, assert.AnError)
+	})
+	t.Run("should prefer the resolved resource", func(t *testing.T) {
+		// given
+		resolved := &ResourceResult{
+			GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+			Namespace:        testNamespace,
+			Name:             "my-deployment",
+		}
+
+		// when
+		sut := newDocumentError(assert.AnError, doc, resolved, namespaceOf)
+
+		// then
+		assert.Equal(t, schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, sut.GroupVersionKind())
+		assert.Equal(t, testNamespace, sut.Namespace())
+		assert.Equal(t, "my-deployment", sut.Name())
+	})
+}
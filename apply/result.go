@@ -0,0 +1,66 @@
+package apply
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ApplyResult describes the outcome of a Builder run.
+type ApplyResult struct {
+	// Documents contains one entry per YAML document that was sent to the Kubernetes API, in order of application.
+	// Documents which were skipped by an ApplyFilter are not listed.
+	Documents []DocumentResult
+	// Pruned contains the resources which were deleted because they were removed from the apply set. It is only
+	// filled if pruning was enabled.
+	Pruned []*unstructured.Unstructured
+	// Statuses contains the last observed readiness of every applied resource. It is only filled if waiting was
+	// enabled.
+	Statuses []ResourceStatus
+}
+
+// ApplyOperation describes how an apply affected a resource.
+type ApplyOperation string
+
+const (
+	// ApplyOperationCreated marks a resource which did not exist before.
+	ApplyOperationCreated ApplyOperation = "created"
+	// ApplyOperationConfigured marks an existing resource which was modified.
+	ApplyOperationConfigured ApplyOperation = "configured"
+	// ApplyOperationUnchanged marks an existing resource which already was in the desired state.
+	ApplyOperationUnchanged ApplyOperation = "unchanged"
+	// ApplyOperationUnknown marks a resource whose state before the apply could not be read, f. i. because the
+	// applier lacks the permission to get it.
+	ApplyOperationUnknown ApplyOperation = "unknown"
+)
+
+// ResourceResult describes a single resource after it was applied.
+type ResourceResult struct {
+	// Object contains the resource as it was returned by the Kubernetes API. During a dry-run this is the
+	// server-computed resource which was not persisted.
+	Object *unstructured.Unstructured
+	// GroupVersionKind identifies the type of the resource.
+	GroupVersionKind schema.GroupVersionKind
+	// GroupVersionResource identifies the API endpoint which serves the resource.
+	GroupVersionResource schema.GroupVersionResource
+	// Namespace contains the namespace of the resource. It is empty for cluster-scoped resources.
+	Namespace string
+	// Name contains the name of the resource.
+	Name string
+	// UID contains the UID which was assigned by the Kubernetes API.
+	UID types.UID
+	// ResourceVersion contains the resource version after the apply.
+	ResourceVersion string
+	// Operation tells whether the resource was created, configured or left unchanged.
+	Operation ApplyOperation
+	// Duration contains the time it took to apply the resource.
+	Duration time.Duration
+}
+
+// DocumentResult describes a single YAML document after it was sent to the Kubernetes API.
+type DocumentResult struct {
+	DocumentReference
+	ResourceResult
+}
@@ -0,0 +1,274 @@
+package apply
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+)
+
+// builtinTemplateFuncs returns the functions which are available in every template. The functions follow the
+// semantics of their Sprig and Helm counterparts, so that existing templates can be reused.
+func builtinTemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// defaults and flow control
+		"default":  defaultValue,
+		"empty":    isEmpty,
+		"coalesce": coalesce,
+		"ternary":  ternary,
+		"required": required,
+		"fail":     fail,
+
+		// strings
+		"quote":      quote,
+		"squote":     squote,
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"title":      title,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+		"indent":     indent,
+		"nindent":    func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+		"toString":   toString,
+		"join":       join,
+		"splitList":  func(sep, s string) []string { return strings.Split(s, sep) },
+
+		// encodings
+		"b64enc":    func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec":    b64dec,
+		"sha256sum": sha256sum,
+		"toJson":    toJSON,
+		"fromJson":  fromJSON,
+		"toYaml":    toYAML,
+		"fromYaml":  fromYAML,
+
+		// collections
+		"list": func(items ...interface{}) []interface{} { return items },
+		"dict": dict,
+		"get":  func(d map[string]interface{}, key string) interface{} { return d[key] },
+		"set": func(d map[string]interface{}, key string, value interface{}) map[string]interface{} {
+			d[key] = value
+			return d
+		},
+		"hasKey": func(d map[string]interface{}, key string) bool { _, ok := d[key]; return ok },
+		"keys":   keys,
+	}
+}
+
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Complex64, reflect.Complex128:
+		return v.Complex() == 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	case reflect.Struct:
+		return false
+	default:
+		return v.IsZero()
+	}
+}
+
+// defaultValue returns the given value or the default if the value is empty. The value is optional so that
+// `.Missing | default "x"` works.
+func defaultValue(defaultVal interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || isEmpty(given[0]) {
+		return defaultVal
+	}
+
+	return given[0]
+}
+
+func coalesce(values ...interface{}) interface{} {
+	for _, value := range values {
+		if !isEmpty(value) {
+			return value
+		}
+	}
+
+	return nil
+}
+
+func ternary(trueValue, falseValue interface{}, condition bool) interface{} {
+	if condition {
+		return trueValue
+	}
+
+	return falseValue
+}
+
+func required(message string, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, errors.New(message)
+	}
+	if s, ok := value.(string); ok && s == "" {
+		return nil, errors.New(message)
+	}
+
+	return value, nil
+}
+
+func fail(message string) (string, error) {
+	return "", errors.New(message)
+}
+
+func quote(values ...interface{}) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != nil {
+			quoted = append(quoted, fmt.Sprintf("%q", toString(value)))
+		}
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+func squote(values ...interface{}) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != nil {
+			quoted = append(quoted, fmt.Sprintf("'%s'", toString(value)))
+		}
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+func title(s string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+
+	return strings.Join(words, " ")
+}
+
+func indent(spaces int, s string) string {
+	padding := strings.Repeat(" ", spaces)
+	return padding + strings.ReplaceAll(s, "\n", "\n"+padding)
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func join(sep string, values interface{}) string {
+	v := reflect.ValueOf(values)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return toString(values)
+	}
+
+	parts := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		parts = append(parts, toString(v.Index(i).Interface()))
+	}
+
+	return strings.Join(parts, sep)
+}
+
+func b64dec(s string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+
+	return string(decoded), nil
+}
+
+func sha256sum(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
+
+func toJSON(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+func fromJSON(s string) (map[string]interface{}, error) {
+	decoded := map[string]interface{}{}
+	err := json.Unmarshal([]byte(s), &decoded)
+	return decoded, err
+}
+
+// toYAML marshals the value without the trailing newline so that it can be combined with nindent.
+func toYAML(value interface{}) (string, error) {
+	encoded, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(encoded), "\n"), nil
+}
+
+func fromYAML(s string) (map[string]interface{}, error) {
+	decoded := map[string]interface{}{}
+	err := yaml.Unmarshal([]byte(s), &decoded)
+	return decoded, err
+}
+
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict requires an even number of arguments")
+	}
+
+	d := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		d[toString(pairs[i])] = pairs[i+1]
+	}
+
+	return d, nil
+}
+
+func keys(d map[string]interface{}) []string {
+	result := make([]string, 0, len(d))
+	for key := range d {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+
+	return result
+}
@@ -0,0 +1,116 @@
+package apply
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoTemplateRenderer_Render_functions(t *testing.T) {
+	values := map[string]interface{}{
+		"name":     "le-app",
+		"empty":    "",
+		"replicas": 2,
+		"labels":   map[string]interface{}{"app": "le-app", "tier": "web"},
+		"password": "secret",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"default for missing value", `{{ .missing | default "fallback" }}`, "fallback"},
+		{"default for empty value", `{{ .empty | default "fallback" }}`, "fallback"},
+		{"default keeps value", `{{ .name | default "fallback" }}`, "le-app"},
+		{"coalesce", `{{ coalesce .empty .missing .name }}`, "le-app"},
+		{"ternary", `{{ ternary "yes" "no" (eq .replicas 2) }}`, "yes"},
+		{"quote", `{{ .name | quote }}`, `"le-app"`},
+		{"squote", `{{ .replicas | squote }}`, `'2'`},
+		{"upper", `{{ .name | upper }}`, "LE-APP"},
+		{"title", `{{ "hello world" | title }}`, "Hello World"},
+		{"trimSuffix", `{{ .name | trimSuffix "-app" }}`, "le"},
+		{"replace", `{{ .name | replace "-" "_" }}`, "le_app"},
+		{"b64enc", `{{ .password | b64enc }}`, "c2VjcmV0"},
+		{"b64dec", `{{ "c2VjcmV0" | b64dec }}`, "secret"},
+		{"sha256sum", `{{ "a" | sha256sum }}`, "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"},
+		{"toJson", `{{ .labels | toJson }}`, `{"app":"le-app","tier":"web"}`},
+		{"toYaml with nindent", `labels:{{ .labels | toYaml | nindent 2 }}`, "labels:\n  app: le-app\n  tier: web"},
+		{"fromYaml", `{{ (fromYaml "key: value").key }}`, "value"},
+		{"dict and keys", `{{ keys (dict "b" 1 "a" 2) | join "," }}`, "a,b"},
+		{"list", `{{ list 1 2 3 | join "-" }}`, "1-2-3"},
+		{"hasKey", `{{ hasKey .labels "tier" }}`, "true"},
+		{"include", `{{ define "app.name" }}{{ .name }}-x{{ end }}{{ include "app.name" . | upper }}`, "LE-APP-X"},
+		{"tpl", `{{ tpl "{{ .name }}" . }}`, "le-app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := (&GoTemplateRenderer{}).Render(testFile1, []byte(tt.template), values)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(actual))
+		})
+	}
+
+	t.Run("should fail for a missing required value", func(t *testing.T) {
+		_, err := (&GoTemplateRenderer{}).Render(testFile1, []byte(`{{ required "image is required" .image }}`), values)
+
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "image is required")
+	})
+	t.Run("should fail on purpose", func(t *testing.T) {
+		_, err := (&GoTemplateRenderer{}).Render(testFile1, []byte(`{{ fail "not supported" }}`), values)
+
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "not supported")
+	})
+}
+
+func TestGoTemplateRenderer_Render_options(t *testing.T) {
+	values := map[string]interface{}{"name": "le-app"}
+
+	t.Run("should call custom functions", func(t *testing.T) {
+		sut := &GoTemplateRenderer{Funcs: template.FuncMap{"shout": func(s string) string { return strings.ToUpper(s) + "!" }}}
+
+		actual, err := sut.Render(testFile1, []byte(`{{ shout .name }}`), values)
+
+		require.NoError(t, err)
+		assert.Equal(t, "LE-APP!", string(actual))
+	})
+	t.Run("should use custom delimiters", func(t *testing.T) {
+		sut := &GoTemplateRenderer{LeftDelim: "[[", RightDelim: "]]"}
+
+		actual, err := sut.Render(testFile1, []byte(`[[ .name ]] {{ .kept }}`), values)
+
+		require.NoError(t, err)
+		assert.Equal(t, "le-app {{ .kept }}", string(actual))
+	})
+	t.Run("should fail for missing keys in strict mode", func(t *testing.T) {
+		sut := &GoTemplateRenderer{Strict: true}
+
+		_, err := sut.Render(testFile1, []byte(`{{ .missing }}`), values)
+
+		require.Error(t, err)
+		assert.ErrorContains(t, err, `map has no entry for key "missing"`)
+	})
+	t.Run("should render missing keys in lenient mode", func(t *testing.T) {
+		actual, err := (&GoTemplateRenderer{}).Render(testFile1, []byte(`{{ .missing }}`), values)
+
+		require.NoError(t, err)
+		assert.Equal(t, "<no value>", string(actual))
+	})
+}
+
+func TestBuilder_WithTemplateFuncs(t *testing.T) {
+	t.Run("should merge functions", func(t *testing.T) {
+		sut := NewBuilder(&mockApplier{})
+
+		sut.WithTemplateFuncs(template.FuncMap{"a": strings.ToUpper}).
+			WithTemplateFuncs(template.FuncMap{"b": strings.ToLower})
+
+		assert.Len(t, sut.goTemplateRenderer.Funcs, 2)
+	})
+}
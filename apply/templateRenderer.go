@@ -0,0 +1,150 @@
+package apply
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"text/template"
+)
+
+// TemplateRenderer renders the content of a file with the template object which was passed to Builder.WithTemplate.
+// Implementations can be selected per file, so that f. i. Go templates and envsubst-style files can be mixed.
+type TemplateRenderer interface {
+	// Render returns the rendered content of the given file. The filename is only used for error messages.
+	Render(filename string, content []byte, templateObject interface{}) ([]byte, error)
+}
+
+// GoTemplateRenderer renders files as Go templates with the functions of builtinTemplateFuncs. It is used for all
+// files without an explicitly selected renderer.
+type GoTemplateRenderer struct {
+	// Funcs are added to the built-in functions. They replace built-in functions of the same name.
+	Funcs template.FuncMap
+	// LeftDelim and RightDelim replace the action delimiters "{{" and "}}" if they are not empty.
+	LeftDelim  string
+	RightDelim string
+	// Strict makes rendering fail if a missing map key is accessed instead of rendering "<no value>".
+	Strict bool
+}
+
+// Render renders the Go template of the given file. Besides the built-in functions and the configured functions the
+// template may call include and tpl which render named templates and strings with the same settings.
+func (r *GoTemplateRenderer) Render(filename string, templateText []byte, templateObject interface{}) ([]byte, error) {
+	const templateName = "t"
+	tpl := template.New(templateName).Delims(r.LeftDelim, r.RightDelim)
+	if r.Strict {
+		tpl = tpl.Option("missingkey=error")
+	}
+
+	includedTemplates := map[string]int{}
+	funcs := builtinTemplateFuncs()
+	funcs["include"] = func(name string, data interface{}) (string, error) {
+		// guard against templates which include themselves
+		if includedTemplates[name] > 100 {
+			return "", fmt.Errorf("template %s included itself too often", name)
+		}
+		includedTemplates[name]++
+		defer func() { includedTemplates[name]-- }()
+
+		buf := &bytes.Buffer{}
+		err := tpl.ExecuteTemplate(buf, name, data)
+		return buf.String(), err
+	}
+	funcs["tpl"] = func(text string, data interface{}) (string, error) {
+		clone, err := tpl.Clone()
+		if err != nil {
+			return "", err
+		}
+		parsed, err := clone.New("tpl").Parse(text)
+		if err != nil {
+			return "", err
+		}
+
+		buf := &bytes.Buffer{}
+		err = parsed.Execute(buf, data)
+		return buf.String(), err
+	}
+	for name, fn := range r.Funcs {
+		funcs[name] = fn
+	}
+	tpl = tpl.Funcs(funcs)
+
+	parsed, err := tpl.Parse(string(templateText))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template for file %s: %w", filename, err)
+	}
+
+	resultWriter := bytes.NewBuffer([]byte{})
+
+	err = parsed.ExecuteTemplate(resultWriter, templateName, templateObject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template for file %s: %w", filename, err)
+	}
+
+	return resultWriter.Bytes(), nil
+}
+
+// envsubstPattern matches ${VAR} and ${VAR:-default}.
+var envsubstPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// EnvsubstRenderer replaces ${VAR} and ${VAR:-default} placeholders like envsubst does. Other content, including Go
+// template actions, is kept as it is. Variables are looked up in the template object, which must be a
+// map[string]string or a map[string]interface{}. If the template object is nil, the variables are looked up in the
+// environment of the process.
+type EnvsubstRenderer struct {
+	// Strict makes rendering fail for undefined variables without default value instead of replacing them with an
+	// empty string.
+	Strict bool
+}
+
+// Render replaces all placeholders of the given file.
+func (r *EnvsubstRenderer) Render(filename string, content []byte, templateObject interface{}) ([]byte, error) {
+	lookup, err := envsubstLookup(templateObject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template for file %s: %w", filename, err)
+	}
+
+	var undefined []string
+	rendered := envsubstPattern.ReplaceAllFunc(content, func(match []byte) []byte {
+		groups := envsubstPattern.FindSubmatch(match)
+		name := string(groups[1])
+		if value, ok := lookup(name); ok && value != "" {
+			return []byte(value)
+		}
+		if len(groups[2]) > 0 {
+			return groups[3]
+		}
+		if _, ok := lookup(name); !ok {
+			undefined = append(undefined, name)
+		}
+		return nil
+	})
+
+	if r.Strict && len(undefined) > 0 {
+		return nil, fmt.Errorf("failed to render template for file %s: undefined variables %v", filename, undefined)
+	}
+
+	return rendered, nil
+}
+
+func envsubstLookup(templateObject interface{}) (func(name string) (string, bool), error) {
+	switch variables := templateObject.(type) {
+	case nil:
+		return os.LookupEnv, nil
+	case map[string]string:
+		return func(name string) (string, bool) {
+			value, ok := variables[name]
+			return value, ok
+		}, nil
+	case map[string]interface{}:
+		return func(name string) (string, bool) {
+			value, ok := variables[name]
+			if !ok || value == nil {
+				return "", ok
+			}
+			return toString(value), true
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported template object of type %T, expected map[string]string or map[string]interface{}", templateObject)
+	}
+}
@@ -0,0 +1,98 @@
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvsubstRenderer_Render(t *testing.T) {
+	content := []byte("name: ${NAME}\nimage: ${IMAGE:-nginx}\nreplicas: ${REPLICAS}\nkept: {{ .Go }} $NOT_REPLACED\n")
+
+	t.Run("should replace variables from a map", func(t *testing.T) {
+		// given
+		sut := &EnvsubstRenderer{}
+
+		// when
+		actual, err := sut.Render(testFile1, content, map[string]interface{}{"NAME": "le-app", "REPLICAS": 2})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "name: le-app\nimage: nginx\nreplicas: 2\nkept: {{ .Go }} $NOT_REPLACED\n", string(actual))
+	})
+	t.Run("should replace undefined variables with an empty string", func(t *testing.T) {
+		// given
+		sut := &EnvsubstRenderer{}
+
+		// when
+		actual, err := sut.Render(testFile1, []byte("name: '${NAME}'"), map[string]string{})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "name: ''", string(actual))
+	})
+	t.Run("should fail for undefined variables in strict mode", func(t *testing.T) {
+		// given
+		sut := &EnvsubstRenderer{Strict: true}
+
+		// when
+		_, err := sut.Render(testFile1, content, map[string]string{"NAME": "le-app"})
+
+		// then
+		require.Error(t, err)
+		assert.Equal(t, "failed to render template for file /dir/file1.yaml: undefined variables [REPLICAS]", err.Error())
+	})
+	t.Run("should look up the environment without template object", func(t *testing.T) {
+		// given
+		t.Setenv("K8S_APPLY_LIB_TEST_NAME", "from-env")
+		sut := &EnvsubstRenderer{}
+
+		// when
+		actual, err := sut.Render(testFile1, []byte("name: ${K8S_APPLY_LIB_TEST_NAME}"), nil)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "name: from-env", string(actual))
+	})
+	t.Run("should fail for unsupported template objects", func(t *testing.T) {
+		// given
+		sut := &EnvsubstRenderer{}
+
+		// when
+		_, err := sut.Render(testFile1, content, struct{}{})
+
+		// then
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "unsupported template object of type struct {}")
+	})
+}
+
+func TestBuilder_WithTemplate_renderer(t *testing.T) {
+	t.Run("should render each file with its renderer", func(t *testing.T) {
+		// given
+		goDoc := YamlDocument("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Name }}\n")
+		envsubstDoc := YamlDocument("apiVersion: v1\nkind: Secret\nmetadata:\n  name: ${NAME}\n")
+		mockedApplier := &mockApplier{}
+		mockedApplier.On("ApplyWithOptions", mock.Anything, YamlDocument("apiVersion: v1\nkind: Secret\nmetadata:\n  name: from-envsubst\n"), testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{}, nil).Once()
+		mockedApplier.On("ApplyWithOptions", mock.Anything, YamlDocument("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: from-go\n"), testNamespace, ApplyOptions{}).
+			Return(&ResourceResult{}, nil).Once()
+
+		sut := NewBuilder(mockedApplier)
+
+		// when
+		err := sut.WithNamespace(testNamespace).
+			WithYamlResource(testFile1, goDoc).
+			WithTemplate(testFile1, map[string]string{"Name": "from-go"}).
+			WithYamlResource(testFile2, envsubstDoc).
+			WithTemplate(testFile2, map[string]string{"NAME": "from-envsubst"}, &EnvsubstRenderer{}).
+			ExecuteApplyContext(context.Background())
+
+		// then
+		require.NoError(t, err)
+		mockedApplier.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,63 @@
+package apply
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DocumentReference identifies a single YAML document by the file it originates from and by its position inside this
+// file.
+type DocumentReference struct {
+	// Filename contains the name under which the file was added to the Builder.
+	Filename string
+	// Index contains the zero-based position of the document inside the file.
+	Index int
+	// Item contains the one-based position of the resource inside a List or JSON array document. It is zero for
+	// documents which contain a single resource.
+	Item int
+}
+
+// String returns the string representation of this reference.
+func (r DocumentReference) String() string {
+	if r.Item > 0 {
+		return fmt.Sprintf("%s[%d] item %d", r.Filename, r.Index, r.Item)
+	}
+	return fmt.Sprintf("%s[%d]", r.Filename, r.Index)
+}
+
+// UnappliedDocumentsError is returned when a Builder run was interrupted, f. i. because its context was cancelled or
+// exceeded its deadline, before all YAML documents were processed.
+type UnappliedDocumentsError struct {
+	err       error
+	unapplied []DocumentReference
+}
+
+func newUnappliedDocumentsError(err error, docs []sourceDocument) *UnappliedDocumentsError {
+	unapplied := make([]DocumentReference, 0, len(docs))
+	for _, doc := range docs {
+		unapplied = append(unapplied, doc.DocumentReference)
+	}
+
+	return &UnappliedDocumentsError{err: err, unapplied: unapplied}
+}
+
+// Error returns the string representation of this error.
+func (e *UnappliedDocumentsError) Error() string {
+	refs := make([]string, 0, len(e.unapplied))
+	for _, ref := range e.unapplied {
+		refs = append(refs, ref.String())
+	}
+
+	return fmt.Sprintf("run was interrupted, %d document(s) were not processed [%s]: %+v",
+		len(e.unapplied), strings.Join(refs, ", "), e.err)
+}
+
+// Unwrap returns the original error.
+func (e *UnappliedDocumentsError) Unwrap() error {
+	return e.err
+}
+
+// Unapplied returns the references of all documents that were not processed, i. e. not applied to the cluster.
+func (e *UnappliedDocumentsError) Unapplied() []DocumentReference {
+	return e.unapplied
+}
@@ -0,0 +1,34 @@
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnappliedDocumentsError_Error(t *testing.T) {
+	t.Run("should list all unapplied documents", func(t *testing.T) {
+		// given
+		docs := []sourceDocument{
+			{DocumentReference: DocumentReference{Filename: testFile1, Index: 1}},
+			{DocumentReference: DocumentReference{Filename: testFile2, Index: 0}},
+		}
+
+		// when
+		sut := newUnappliedDocumentsError(context.Canceled, docs)
+
+		// then
+		require.Error(t, sut)
+		assert.Equal(t, "run was interrupted, 2 document(s) were not processed "+
+			"[/dir/file1.yaml[1], /dir/file2.yaml[0]]: context canceled", sut.Error())
+	})
+}
+
+func TestUnappliedDocumentsError_Unwrap(t *testing.T) {
+	sut := newUnappliedDocumentsError(context.DeadlineExceeded, nil)
+
+	assert.ErrorIs(t, sut, context.DeadlineExceeded)
+	assert.Empty(t, sut.Unapplied())
+}